@@ -0,0 +1,406 @@
+package asstags
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Alquimista/eyecandy/color"
+)
+
+// tagNames the override tag names, the longest first when one is
+// the prefix of other (\fscx before \fs, \pos before \p)
+var tagNames = []string{
+	"xbord", "ybord", "xshad", "yshad", "bord", "shad", "blur", "be",
+	"fscx", "fscy", "fsp", "fs", "frx", "fry", "frz", "fr", "fax", "fay",
+	"fade", "fad", "fn", "fe",
+	"1c", "2c", "3c", "4c", "1a", "2a", "3a", "4a", "alpha", "an",
+	"clip", "c", "a", "pos", "pbo", "p", "move", "org",
+	"iclip", "i", "kf", "ko", "kt", "k", "K", "q", "r", "t", "b", "u", "s",
+}
+
+// Node a node of a parsed line: Text, *Block or *Drawing
+type Node interface {
+	String() string
+}
+
+// Text a run of text, with the \N, \n and \h escapes
+type Text string
+
+// String get the Text as a String
+func (t Text) String() string {
+	return string(t)
+}
+
+// Block an override block: {\tag...}
+type Block struct {
+	Tags []*Tag
+}
+
+// String get the Block as a String
+func (b *Block) String() string {
+	s := "{"
+	for _, tag := range b.Tags {
+		s += tag.String()
+	}
+	return s + "}"
+}
+
+// Tag an override tag. The tags with parentheses (\pos, \move, \t,
+// \clip...) have Args, the others a Value (\fs40, \fnArial, \1c&HFF&).
+// The text of a block out of the tags (a comment) is a Tag without Name.
+type Tag struct {
+	Name    string
+	Value   string
+	Args    []string // arguments in parentheses, without the animated tags
+	Parens  bool     // the arguments are in parentheses
+	Tags    []*Tag   // animated tags of \t
+	Drawing *Drawing // vector of \clip and \iclip
+	raw     string   // the parsed text
+	parsed  string   // format() of the parsed Tag
+}
+
+// String get the Tag as a String, the text it was parsed from
+// while the Tag isn't changed
+func (t *Tag) String() string {
+	s := t.format()
+	if t.raw != "" && s == t.parsed {
+		return t.raw
+	}
+	return s
+}
+
+// format write the Tag with its fields
+func (t *Tag) format() string {
+	if t.Name == "" {
+		return t.Value
+	}
+	if !t.Parens {
+		return `\` + t.Name + t.Value
+	}
+	args := append([]string{}, t.Args...)
+	if t.Drawing != nil {
+		args = append(args, t.Drawing.String())
+	}
+	if len(t.Tags) > 0 {
+		tags := ""
+		for _, tag := range t.Tags {
+			tags += tag.String()
+		}
+		args = append(args, tags)
+	}
+	return `\` + t.Name + "(" + strings.Join(args, ",") + ")"
+}
+
+// Float get the Value as a number
+func (t *Tag) Float() (float64, error) {
+	f, err := strconv.ParseFloat(t.Value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("asstags: \\%s: invalid number %q", t.Name, t.Value)
+	}
+	return f, nil
+}
+
+// Int get the Value as an integer
+func (t *Tag) Int() (int, error) {
+	f, err := t.Float()
+	return int(f), err
+}
+
+// Floats get the Args as numbers
+func (t *Tag) Floats() ([]float64, error) {
+	nums := make([]float64, len(t.Args))
+	for i, arg := range t.Args {
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("asstags: \\%s: invalid number %q",
+				t.Name, arg)
+		}
+		nums[i] = f
+	}
+	return nums, nil
+}
+
+// Color get the Value of a color (\c, \1c...) or alpha (\alpha, \1a...)
+// tag, the alpha is in the A component
+func (t *Tag) Color() (*color.Color, error) {
+	v := strings.TrimSuffix(strings.TrimPrefix(
+		strings.TrimPrefix(t.Value, "&"), "H"), "&")
+	if t.Name == "alpha" || len(t.Name) == 2 && t.Name[1] == 'a' {
+		a, err := strconv.ParseUint(v, 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("asstags: \\%s: invalid alpha %q",
+				t.Name, t.Value)
+		}
+		return &color.Color{A: uint8(a)}, nil
+	}
+	c, err := color.ParseSSA("&H" + v + "&")
+	if err != nil {
+		return nil, fmt.Errorf("asstags: \\%s: invalid color %q",
+			t.Name, t.Value)
+	}
+	return c, nil
+}
+
+// DrawCommand a command of a vector drawing: m, n, l, b, s, p or c
+type DrawCommand struct {
+	Name   string
+	Points []float64 // x, y pairs
+}
+
+// Drawing a vector drawing, the text of the \p tag or a \clip vector
+type Drawing struct {
+	Commands []DrawCommand
+	raw      string // the parsed text
+	parsed   string // format() of the parsed Drawing
+}
+
+// String get the Drawing as a String, the text it was parsed from
+// (with its spacing and number format) while the Drawing isn't changed
+func (d *Drawing) String() string {
+	s := d.format()
+	if d.raw != "" && s == d.parsed {
+		return d.raw
+	}
+	return s
+}
+
+// format write the commands of the Drawing
+func (d *Drawing) format() string {
+	var parts []string
+	for _, cmd := range d.Commands {
+		parts = append(parts, cmd.Name)
+		for _, p := range cmd.Points {
+			parts = append(parts, strconv.FormatFloat(p, 'f', -1, 64))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseDrawing parse the commands of a vector drawing
+func ParseDrawing(s string) (*Drawing, error) {
+	d := &Drawing{}
+	for _, field := range strings.Fields(s) {
+		switch field {
+		case "m", "n", "l", "b", "s", "p", "c":
+			d.Commands = append(d.Commands, DrawCommand{Name: field})
+			continue
+		}
+		f, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("asstags: invalid drawing %q", field)
+		}
+		if len(d.Commands) == 0 {
+			return nil, fmt.Errorf("asstags: drawing without command")
+		}
+		cmd := &d.Commands[len(d.Commands)-1]
+		cmd.Points = append(cmd.Points, f)
+	}
+	d.raw, d.parsed = s, d.format()
+	return d, nil
+}
+
+// Nodes the nodes of a parsed line
+type Nodes []Node
+
+// String serialize the Nodes, the inverse of Parse
+func (nodes Nodes) String() string {
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(n.String())
+	}
+	return b.String()
+}
+
+// Text get the text of the Nodes without the override blocks
+// and the drawings
+func (nodes Nodes) Text() string {
+	var b strings.Builder
+	for _, n := range nodes {
+		if t, ok := n.(Text); ok {
+			b.WriteString(string(t))
+		}
+	}
+	return b.String()
+}
+
+// Parse parse the text of a line into text runs, override blocks and
+// drawings (the text while \p is greater than 0). Like the renderers
+// an unclosed block is text, and unknown tags are kept by name.
+func Parse(text string) Nodes {
+	var nodes Nodes
+	drawing := false
+	for text != "" {
+		start := strings.Index(text, "{")
+		end := -1
+		if start >= 0 {
+			end = strings.Index(text[start:], "}")
+		}
+		if start < 0 || end < 0 {
+			nodes = appendText(nodes, text, drawing)
+			break
+		}
+		nodes = appendText(nodes, text[:start], drawing)
+		block := parseBlock(text[start+1 : start+end])
+		for _, tag := range block.Tags {
+			if tag.Name == "p" {
+				n, _ := tag.Int()
+				drawing = n > 0
+			}
+		}
+		nodes = append(nodes, block)
+		text = text[start+end+1:]
+	}
+	return nodes
+}
+
+// appendText append a text run, or a drawing if it can be parsed
+func appendText(nodes Nodes, text string, drawing bool) Nodes {
+	if text == "" {
+		return nodes
+	}
+	if drawing {
+		if d, err := ParseDrawing(text); err == nil {
+			return append(nodes, d)
+		}
+	}
+	return append(nodes, Text(text))
+}
+
+// parseBlock parse the tags of an override block, without the braces
+func parseBlock(s string) *Block {
+	return &Block{Tags: parseTags(s)}
+}
+
+// parseTags parse a sequence of override tags
+func parseTags(s string) (tags []*Tag) {
+	for s != "" {
+		i := strings.Index(s, `\`)
+		if i != 0 {
+			// comment
+			if i < 0 {
+				i = len(s)
+			}
+			tags = append(tags, &Tag{Value: s[:i]})
+			s = s[i:]
+			continue
+		}
+		tag, rest := parseTag(s[1:])
+		tag.raw, tag.parsed = s[:len(s)-len(rest)], tag.format()
+		tags = append(tags, tag)
+		s = rest
+	}
+	return tags
+}
+
+// parseTag parse the tag at the start of s (without the backslash),
+// return the rest of s
+func parseTag(s string) (*Tag, string) {
+	tag := &Tag{}
+	for _, name := range tagNames {
+		if strings.HasPrefix(s, name) {
+			tag.Name = name
+			break
+		}
+	}
+	if tag.Name == "" {
+		// unknown tag, the letters are the name
+		n := 0
+		for n < len(s) && (s[n] >= 'a' && s[n] <= 'z' ||
+			s[n] >= 'A' && s[n] <= 'Z') {
+			n++
+		}
+		tag.Name = s[:n]
+	}
+	if tag.Name == "" {
+		// a backslash without tag name, kept as a comment
+		end := strings.Index(s, `\`)
+		if end < 0 {
+			end = len(s)
+		}
+		return &Tag{Value: `\` + s[:end]}, s[end:]
+	}
+	s = s[len(tag.Name):]
+
+	rest := strings.TrimLeft(s, " ")
+	if strings.HasPrefix(rest, "(") {
+		// arguments in parentheses, an unclosed one end with the block
+		depth, end := 0, len(rest)
+		for i, c := range rest {
+			if c == '(' {
+				depth++
+			} else if c == ')' {
+				depth--
+				if depth == 0 {
+					end = i
+					break
+				}
+			}
+		}
+		inner := rest[1:end]
+		if end < len(rest) {
+			end++
+		}
+		tag.Parens = true
+		tag.setArgs(splitArgs(inner))
+		return tag, rest[end:]
+	}
+
+	// the value end with the next tag
+	end := strings.Index(s, `\`)
+	if end < 0 {
+		end = len(s)
+	}
+	tag.Value = strings.TrimSpace(s[:end])
+	return tag, s[end:]
+}
+
+// setArgs set the arguments of a tag with parentheses,
+// parsing the animated tags of \t and the vector of \clip
+func (t *Tag) setArgs(args []string) {
+	switch t.Name {
+	case "t":
+		for i, arg := range args {
+			if strings.HasPrefix(arg, `\`) {
+				t.Args = args[:i]
+				t.Tags = parseTags(strings.Join(args[i:], ","))
+				return
+			}
+		}
+		t.Args = args
+	case "clip", "iclip":
+		if len(args) == 1 || len(args) == 2 {
+			if d, err := ParseDrawing(args[len(args)-1]); err == nil {
+				t.Args = args[:len(args)-1]
+				t.Drawing = d
+				return
+			}
+		}
+		t.Args = args
+	default:
+		t.Args = args
+	}
+}
+
+// splitArgs split the arguments of a tag by the commas
+// out of nested parentheses
+func splitArgs(s string) (args []string) {
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(s) != "" || len(args) > 0 {
+		args = append(args, strings.TrimSpace(s[start:]))
+	}
+	return args
+}
@@ -0,0 +1,109 @@
+package asstags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"plain text",
+		`{\b1}bold{\b0} text\Nnew row\h`,
+		`{\fs 40\fnArial Black\1c&H00FF00&\alpha&H80&}spaced`,
+		`{\pos(10, 20.50)\move(0,0,100,100,0,500)}moving`,
+		`{\t(0,500,0.5,\frz360\fscx120)\t(\bord4)}animated`,
+		`{\t(0,200,\clip(0,0,100,100))}nested`,
+		`{\clip(m 0 0 l 100 0 100 100)\iclip(2,m 10.50 0 l 0 10)}clipped`,
+		`{\clip(10,20,30,40)}rect`,
+		`{\p1}m 0 0 l 100 0 100 100  l 0 100.0 {\p0}text`,
+		`{\p1}not a drawing{\p0}`,
+		`{a comment\b1 more}text`,
+		`{\}backslash{\\}`,
+		`{\k20\kf30-fx\K10\ko5\kt0}kara`,
+		`{\unknown5\b1}x`,
+		`{\pos(10,20}unclosed parens`,
+		`{unclosed block\b1`,
+		`{}{\b1}{}empty`,
+	} {
+		if got := Parse(s).String(); got != s {
+			t.Errorf("Parse(%q).String() = %q", s, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	nodes := Parse(`{\b1\pos(10,20)}Hi {\t(0,500,\frz360)}{\p1}m 0 0 l 10 10`)
+	if len(nodes) != 5 {
+		t.Fatalf("got %d nodes, want 5: %#v", len(nodes), nodes)
+	}
+	b, ok := nodes[0].(*Block)
+	if !ok || len(b.Tags) != 2 {
+		t.Fatalf("nodes[0] = %#v, want a Block of 2 tags", nodes[0])
+	}
+	if tag := b.Tags[0]; tag.Name != "b" || tag.Value != "1" || tag.Parens {
+		t.Errorf("\\b1 = %+v", tag)
+	}
+	if tag := b.Tags[1]; tag.Name != "pos" || !tag.Parens ||
+		!reflect.DeepEqual(tag.Args, []string{"10", "20"}) {
+		t.Errorf("\\pos = %+v", tag)
+	}
+	if text, ok := nodes[1].(Text); !ok || text != "Hi " {
+		t.Errorf("nodes[1] = %#v, want Text \"Hi \"", nodes[1])
+	}
+	tr := nodes[2].(*Block).Tags[0]
+	if tr.Name != "t" || !reflect.DeepEqual(tr.Args, []string{"0", "500"}) ||
+		len(tr.Tags) != 1 || tr.Tags[0].Name != "frz" ||
+		tr.Tags[0].Value != "360" {
+		t.Errorf("\\t = %+v", tr)
+	}
+	d, ok := nodes[4].(*Drawing)
+	if !ok {
+		t.Fatalf("nodes[4] = %#v, want a Drawing", nodes[4])
+	}
+	want := []DrawCommand{{"m", []float64{0, 0}}, {"l", []float64{10, 10}}}
+	if !reflect.DeepEqual(d.Commands, want) {
+		t.Errorf("Commands = %v, want %v", d.Commands, want)
+	}
+	if got := nodes.Text(); got != "Hi " {
+		t.Errorf("Text() = %q, want \"Hi \"", got)
+	}
+}
+
+func TestParseChanged(t *testing.T) {
+	// a changed Tag or Drawing is written from its fields
+	nodes := Parse(`{\fs 40\pos(1, 2)}{\p1}m 0 0 l 10.50 0`)
+	tags := nodes[0].(*Block).Tags
+	tags[0].Value = "50"
+	tags[1].Args[1] = "3"
+	d := nodes[2].(*Drawing)
+	d.Commands[1].Points[0] = 20
+	want := `{\fs50\pos(1,3)}{\p1}m 0 0 l 20 0`
+	if got := nodes.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestParseDrawing(t *testing.T) {
+	tests := []struct {
+		s   string
+		err bool
+	}{
+		{"m 0 0 l 10 10", false},
+		{" m 0 0 b 1 2 3 4 5 6 ", false},
+		{"m -1.5 2e1", false},
+		{"0 0 l 10 10", true},
+		{"m 0 0 x 10", true},
+	}
+	for _, tt := range tests {
+		d, err := ParseDrawing(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseDrawing(%q) error = %v, want error %v",
+				tt.s, err, tt.err)
+			continue
+		}
+		if err == nil && d.String() != tt.s {
+			t.Errorf("ParseDrawing(%q).String() = %q", tt.s, d.String())
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/Alquimista/eyecandy/utils"
 )
@@ -42,11 +44,116 @@ const (
 )
 
 // reSSAfmt regex time stamp
-var reSSAfmt = regexp.MustCompile(`(\d):(\d+):(\d+).(\d+)`)
+var reSSAfmt = regexp.MustCompile(`^(-)?(\d+):(\d{1,2}):(\d{1,2})(?:[.,](\d+))?$`)
 
-// MStoFrames Convert Frames to Milliseconds
+// Time a time (or duration) in milliseconds of an SSA/ASS Subtitle Script
+type Time int
+
+// Parse parse an SSA timestamp "H:MM:SS.CC" (H=Hour, M=Minute, S=Second,
+// C=centisecond). The hours can have more than one digit
+// and the negative times are clamped to zero.
+func Parse(s string) (Time, error) {
+	tm := reSSAfmt.FindStringSubmatch(strings.TrimSpace(s))
+	if tm == nil {
+		return 0, fmt.Errorf("asstime: invalid time %q", s)
+	}
+	h, _ := strconv.Atoi(tm[2])
+	m, _ := strconv.Atoi(tm[3])
+	sec, _ := strconv.Atoi(tm[4])
+	// decimal fraction of second (".5" is 500ms, ".05" is 50ms)
+	ms := 0
+	if frac := tm[5]; frac != "" {
+		frac = (frac + "00")[:3]
+		ms, _ = strconv.Atoi(frac)
+	}
+	if tm[1] == "-" {
+		return 0, nil
+	}
+	return Time(h*Hour + m*Minute + sec*Second + ms), nil
+}
+
+// MustParse parse an SSA timestamp, panic if it's malformed
+func MustParse(s string) Time {
+	t, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// NewTime create a Time from its components
+func NewTime(h, m, s, ms int) Time {
+	return Time(h*Hour + m*Minute + s*Second + ms)
+}
+
+// MS get the Time in milliseconds
+func (t Time) MS() int {
+	return int(t)
+}
+
+// Seconds get the Time in seconds
+func (t Time) Seconds() float64 {
+	return float64(t) / Second
+}
+
+// Add get the Time t+d
+func (t Time) Add(d Time) Time {
+	return t + d
+}
+
+// Sub get the Time t-d
+func (t Time) Sub(d Time) Time {
+	return t - d
+}
+
+// Scale get the Time multiplied by f, rounded to milliseconds
+func (t Time) Scale(f float64) Time {
+	return Time(math.Floor(float64(t)*f + 0.5))
+}
+
+// Clamp limit the Time to the range [min, max]
+func (t Time) Clamp(min, max Time) Time {
+	if t < min {
+		return min
+	}
+	if t > max {
+		return max
+	}
+	return t
+}
+
+// Positive get the Time, or zero if it's negative
+func (t Time) Positive() Time {
+	if t < 0 {
+		return 0
+	}
+	return t
+}
+
+// Split get the components of the Time rounded to centiseconds,
+// the negative times are clamped to zero.
+func (t Time) Split() (h, m, s, cs int) {
+	total := (int(t.Positive()) + Centisecond/2) / Centisecond
+	sec, cs := utils.DivMod(total, 100)
+	min, s := utils.DivMod(sec, 60)
+	h, m = utils.DivMod(min, 60)
+	return h, m, s, cs
+}
+
+// String get the Time as an SSA timestamp
+func (t Time) String() string {
+	h, m, s, cs := t.Split()
+	return fmt.Sprintf("%01d:%02d:%02d.%02d", h, m, s, cs)
+}
+
+// Frames convert the Time to Frames
+func (t Time) Frames(framerate float64) int {
+	return MStoFrames(int(t), framerate)
+}
+
+// MStoFrames Convert Milliseconds to Frames
 func MStoFrames(ms int, framerate float64) int {
-	return int(math.Ceil(framerate * float64(ms/Second)))
+	return int(math.Ceil(framerate * float64(ms) / Second))
 }
 
 // FramesToMS Convert Frames to Milliseconds
@@ -56,23 +163,16 @@ func FramesToMS(frames int, framerate float64) int {
 
 // MStoSSA Convert Milliseconds to SSA timestamp
 func MStoSSA(milli int) string {
-	sec, ms := utils.DivMod(milli, 1000)
-	min, s := utils.DivMod(sec, 60)
-	h, m := utils.DivMod(min, 60)
-	cs, _ := utils.DivMod(ms, 10)
-	return fmt.Sprintf("%01d:%02d:%02d.%02d", h, m, s, cs)
+	return Time(milli).String()
 }
 
 // SSAtoMS Convert SSA timestamp to Milliseconds
+//
+// Deprecated: SSAtoMS return 0 on malformed timestamps, use Parse.
 func SSAtoMS(t string) int {
-	h, m, s, cs := ssatoSplit(t)
-	return (h*Hour + m*Minute + s*Second + cs*Centisecond)
-}
-
-// ssatoSplit split components of SSA timestamp
-func ssatoSplit(t string) (h, m, s, cs int) {
-	//H:MM:SS.CC (H=Hour, M=Minute, S=Second, C=centisecond)
-	tm := reSSAfmt.FindStringSubmatch(t)
-	return utils.Str2int(tm[1]), utils.Str2int(tm[2]),
-		utils.Str2int(tm[3]), utils.Str2int(tm[4])
+	tm, err := Parse(t)
+	if err != nil {
+		return 0
+	}
+	return int(tm)
 }
@@ -0,0 +1,108 @@
+package asstime
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Time
+	}{
+		{"0:00:00.00", 0},
+		{"0:00:01.00", 1000},
+		{"1:02:03.45", 3723450},
+		{"12:00:00.00", 43200000},
+		{"123:00:00.00", 442800000},
+		// the fraction is a decimal fraction of second
+		{"0:00:01.5", 1500},
+		{"0:00:01.05", 1050},
+		{"0:00:01.123", 1123},
+		{"0:00:01.1239", 1123},
+		{"0:00:01,25", 1250},
+		{"0:00:01", 1000},
+		{"0:1:2.3", 62300},
+		{" 0:00:01.00 ", 1000},
+		// negative times are clamped
+		{"-0:00:01.00", 0},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, s := range []string{
+		"", "later", "1:02", "0:00:01.", "0:00:01.a", "0:000:01.00",
+		"0:00:100.00", "1h:00:00.00", "--0:00:01.00",
+	} {
+		if got, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) = %d, want an error", s, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		t    Time
+		want string
+	}{
+		{0, "0:00:00.00"},
+		{1230, "0:00:01.23"},
+		// rounded to centiseconds, not truncated
+		{1234, "0:00:01.23"},
+		{1235, "0:00:01.24"},
+		{1999, "0:00:02.00"},
+		{59995, "0:01:00.00"},
+		{3599995, "1:00:00.00"},
+		{3723450, "1:02:03.45"},
+		{NewTime(10, 0, 0, 0), "10:00:00.00"},
+		{NewTime(123, 4, 5, 60), "123:04:05.06"},
+		{4, "0:00:00.00"},
+		{5, "0:00:00.01"},
+		// negative times are clamped
+		{-500, "0:00:00.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.t.String(); got != tt.want {
+			t.Errorf("Time(%d).String() = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestStringParse(t *testing.T) {
+	for _, s := range []string{
+		"0:00:00.00", "0:00:01.23", "1:02:03.45", "9:59:59.99", "10:00:00.01",
+	} {
+		if got := MustParse(s).String(); got != s {
+			t.Errorf("MustParse(%q).String() = %q", s, got)
+		}
+	}
+}
+
+func TestTimeArithmetic(t *testing.T) {
+	tm := NewTime(0, 0, 1, 500)
+	if got := tm.Add(250); got != 1750 {
+		t.Errorf("Add = %d, want 1750", got)
+	}
+	if got := tm.Sub(2000); got != -500 {
+		t.Errorf("Sub = %d, want -500", got)
+	}
+	if got := tm.Sub(2000).Positive(); got != 0 {
+		t.Errorf("Positive = %d, want 0", got)
+	}
+	if got := tm.Scale(1.0 / 3); got != 500 {
+		t.Errorf("Scale = %d, want 500", got)
+	}
+	if got := tm.Clamp(0, 1000); got != 1000 {
+		t.Errorf("Clamp = %d, want 1000", got)
+	}
+	if got := tm.Seconds(); got != 1.5 {
+		t.Errorf("Seconds = %v, want 1.5", got)
+	}
+}
@@ -0,0 +1,248 @@
+package asstime
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FrameTime select how a time is mapped to a frame and back
+type FrameTime int
+
+const (
+	// Exact the frame displayed at a time
+	Exact FrameTime = iota
+	// Start the first frame where a line starting at a time is displayed
+	Start
+	// End the last frame where a line ending at a time is displayed
+	End
+)
+
+// Timecodes the start time of every frame of a video,
+// for constant (CFR) and variable (VFR) frame rate videos.
+// Frames after the last timecode use the average frame rate.
+type Timecodes struct {
+	times []float64 // start time of each frame in milliseconds
+	fps   float64
+}
+
+// NewTimecodes create Timecodes for a constant frame rate
+func NewTimecodes(framerate float64) *Timecodes {
+	return &Timecodes{times: []float64{0}, fps: framerate}
+}
+
+// LoadTimecodes read a v1 or v2 (Matroska/mkvextract) timecode file
+func LoadTimecodes(fn string) (*Timecodes, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("asstime: failed opening timecodes: %s", err)
+	}
+	defer f.Close()
+	return ParseTimecodes(f)
+}
+
+// ParseTimecodes parse a v1 or v2 timecode file
+func ParseTimecodes(r io.Reader) (*Timecodes, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("asstime: failed reading timecodes: %s", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("asstime: empty timecodes file")
+	}
+
+	header := strings.ToLower(strings.TrimPrefix(lines[0], "\uFEFF"))
+	switch {
+	case strings.HasPrefix(header, "# timecode format v1"):
+		return parseTimecodesV1(lines[1:])
+	case strings.HasPrefix(header, "# timecode format v2"),
+		strings.HasPrefix(header, "# timestamp format v2"):
+		return parseTimecodesV2(lines[1:])
+	}
+	return nil, fmt.Errorf("asstime: unknown timecodes format %q", lines[0])
+}
+
+// parseTimecodesV2 one timestamp (ms) by line
+func parseTimecodesV2(lines []string) (*Timecodes, error) {
+	tc := &Timecodes{}
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		t, err := strconv.ParseFloat(line, 64)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"asstime: timecodes line %d: invalid time %q", i+2, line)
+		}
+		if n := len(tc.times); n > 0 && t < tc.times[n-1] {
+			return nil, fmt.Errorf(
+				"asstime: timecodes line %d: time out of order", i+2)
+		}
+		tc.times = append(tc.times, t)
+	}
+	n := len(tc.times)
+	if n < 2 {
+		return nil, fmt.Errorf("asstime: timecodes need at least two frames")
+	}
+	if tc.times[n-1] == tc.times[0] {
+		return nil, fmt.Errorf("asstime: timecodes have zero duration")
+	}
+	tc.fps = float64(n-1) * Second / (tc.times[n-1] - tc.times[0])
+	return tc, nil
+}
+
+// parseTimecodesV1 "Assume fps" and "start,end,fps" frame ranges
+func parseTimecodesV1(lines []string) (*Timecodes, error) {
+	assume := 0.0
+	type frameRange struct {
+		start, end int
+		fps        float64
+	}
+	var ranges []frameRange
+
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(line), "assume ") {
+			fps, err := strconv.ParseFloat(strings.TrimSpace(line[7:]), 64)
+			if err != nil || fps <= 0 {
+				return nil, fmt.Errorf(
+					"asstime: timecodes line %d: invalid frame rate", i+2)
+			}
+			assume = fps
+			continue
+		}
+		f := strings.Split(line, ",")
+		if len(f) != 3 {
+			return nil, fmt.Errorf(
+				"asstime: timecodes line %d: expected start,end,fps", i+2)
+		}
+		start, err1 := strconv.Atoi(strings.TrimSpace(f[0]))
+		end, err2 := strconv.Atoi(strings.TrimSpace(f[1]))
+		fps, err3 := strconv.ParseFloat(strings.TrimSpace(f[2]), 64)
+		if err1 != nil || err2 != nil || err3 != nil ||
+			start < 0 || end < start || fps <= 0 {
+			return nil, fmt.Errorf(
+				"asstime: timecodes line %d: invalid range %q", i+2, line)
+		}
+		ranges = append(ranges, frameRange{start, end, fps})
+	}
+	if assume == 0 {
+		return nil, fmt.Errorf("asstime: timecodes v1 without Assume line")
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+	last := 0
+	for i, r := range ranges {
+		if i > 0 && r.start <= ranges[i-1].end {
+			return nil, fmt.Errorf("asstime: timecodes ranges overlap")
+		}
+		last = r.end
+	}
+
+	// frame durations, the frames outside the ranges use the assumed rate
+	tc := &Timecodes{times: []float64{0}, fps: assume}
+	t := 0.0
+	ri := 0
+	for frame := 0; frame <= last; frame++ {
+		fps := assume
+		for ri < len(ranges) && ranges[ri].end < frame {
+			ri++
+		}
+		if ri < len(ranges) && ranges[ri].start <= frame {
+			fps = ranges[ri].fps
+		}
+		t += Second / fps
+		tc.times = append(tc.times, t)
+	}
+	return tc, nil
+}
+
+// FPS get the frame rate used after the last timecode
+// (the average frame rate for v2 files).
+func (tc *Timecodes) FPS() float64 {
+	return tc.fps
+}
+
+// frameTime start time of a frame in milliseconds (not rounded)
+func (tc *Timecodes) frameTime(frame int) float64 {
+	n := len(tc.times)
+	if frame < 0 {
+		return float64(frame) * Second / tc.fps
+	}
+	if frame >= n {
+		return tc.times[n-1] + float64(frame-n+1)*Second/tc.fps
+	}
+	return tc.times[frame]
+}
+
+// frameAt the frame displayed at ms
+func (tc *Timecodes) frameAt(ms int) int {
+	t := float64(ms)
+	n := len(tc.times)
+	// avoid float errors at the frame boundaries
+	const eps = 1e-6
+	if t < 0 {
+		return int(math.Floor(t*tc.fps/Second + eps))
+	}
+	if last := tc.times[n-1]; t >= last {
+		return n - 1 + int(math.Floor((t-last)*tc.fps/Second+eps))
+	}
+	// first frame starting after ms
+	i := sort.Search(n, func(i int) bool { return tc.times[i] > t+eps })
+	return i - 1
+}
+
+// MsToFrame convert a time in milliseconds to a frame number
+func (tc *Timecodes) MsToFrame(ms int, t FrameTime) int {
+	switch t {
+	case Start:
+		return tc.frameAt(ms-1) + 1
+	case End:
+		return tc.frameAt(ms - 1)
+	}
+	return tc.frameAt(ms)
+}
+
+// FrameToMs convert a frame number to a time in milliseconds.
+// Exact is the first millisecond where the frame is displayed,
+// Start and End are the middle between two frames, the safest times
+// to start or end a line in that frame.
+func (tc *Timecodes) FrameToMs(frame int, t FrameTime) int {
+	switch t {
+	case Start:
+		prev := tc.FrameToMs(frame-1, Exact)
+		cur := tc.FrameToMs(frame, Exact)
+		return prev + (cur-prev+1)/2
+	case End:
+		cur := tc.FrameToMs(frame, Exact)
+		next := tc.FrameToMs(frame+1, Exact)
+		return cur + (next-cur+1)/2
+	}
+	return int(math.Ceil(tc.frameTime(frame) - 1e-6))
+}
+
+// Snap move the start and end times of a line to the frames
+// where it is displayed.
+func (tc *Timecodes) Snap(start, end int) (int, int) {
+	startFrame := tc.MsToFrame(start, Start)
+	endFrame := tc.MsToFrame(end, End)
+	if endFrame < startFrame {
+		// Not displayed in any frame
+		s := tc.FrameToMs(startFrame, Start)
+		return s, s
+	}
+	return tc.FrameToMs(startFrame, Start), tc.FrameToMs(endFrame, End)
+}
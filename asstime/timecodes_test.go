@@ -0,0 +1,166 @@
+package asstime
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustTimecodes(t *testing.T, src string) *Timecodes {
+	t.Helper()
+	tc, err := ParseTimecodes(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tc
+}
+
+func TestMsToFrame(t *testing.T) {
+	cfr := NewTimecodes(FpsPal)
+	// frames 0, 40, 100, 150, then the average rate (20 fps)
+	v2 := mustTimecodes(t, "# timecode format v2\n0\n40\n100\n150\n")
+	// frames 0 and 1 at 25 fps, 2 and 3 at 50 fps, then 25 fps
+	v1 := mustTimecodes(t, "# timecode format v1\nAssume 25\n2,3,50\n")
+
+	tests := []struct {
+		name  string
+		tc    *Timecodes
+		ms    int
+		exact int
+		start int
+		end   int
+	}{
+		{"cfr", cfr, 0, 0, 0, -1},
+		{"cfr", cfr, 1, 0, 1, 0},
+		{"cfr", cfr, 39, 0, 1, 0},
+		{"cfr", cfr, 40, 1, 1, 0},
+		{"cfr", cfr, 41, 1, 2, 1},
+		{"cfr", cfr, 1000, 25, 25, 24},
+		{"cfr", cfr, -40, -1, -1, -2},
+		{"v2", v2, 39, 0, 1, 0},
+		{"v2", v2, 99, 1, 2, 1},
+		{"v2", v2, 100, 2, 2, 1},
+		{"v2", v2, 149, 2, 3, 2},
+		{"v2", v2, 160, 3, 4, 3},
+		{"v2", v2, 200, 4, 4, 3},
+		{"v1", v1, 79, 1, 2, 1},
+		{"v1", v1, 90, 2, 3, 2},
+		{"v1", v1, 100, 3, 3, 2},
+		{"v1", v1, 125, 4, 5, 4},
+		{"v1", v1, 160, 5, 5, 4},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			ft   FrameTime
+			want int
+		}{{Exact, tt.exact}, {Start, tt.start}, {End, tt.end}} {
+			if got := tt.tc.MsToFrame(tt.ms, c.ft); got != c.want {
+				t.Errorf("%s: MsToFrame(%d, %d) = %d, want %d",
+					tt.name, tt.ms, c.ft, got, c.want)
+			}
+		}
+	}
+}
+
+func TestFrameToMs(t *testing.T) {
+	cfr := NewTimecodes(FpsPal)
+	film := NewTimecodes(FpsNtscFilm)
+	v2 := mustTimecodes(t, "# timestamp format v2\n0\n40\n100\n150\n")
+	v1 := mustTimecodes(t, "# timecode format v1\nAssume 25\n2,3,50\n")
+
+	tests := []struct {
+		name  string
+		tc    *Timecodes
+		frame int
+		exact int
+		start int
+		end   int
+	}{
+		{"cfr", cfr, 0, 0, -20, 20},
+		{"cfr", cfr, 1, 40, 20, 60},
+		{"cfr", cfr, 25, 1000, 980, 1020},
+		{"film", film, 1, 42, 21, 63},
+		{"film", film, 2, 84, 63, 105},
+		{"film", film, 24, 1001, 981, 1022},
+		{"v2", v2, 1, 40, 20, 70},
+		{"v2", v2, 2, 100, 70, 125},
+		{"v2", v2, 3, 150, 125, 175},
+		{"v2", v2, 4, 200, 175, 225},
+		{"v1", v1, 2, 80, 60, 90},
+		{"v1", v1, 3, 100, 90, 110},
+		{"v1", v1, 5, 160, 140, 180},
+	}
+	for _, tt := range tests {
+		for _, c := range []struct {
+			ft   FrameTime
+			want int
+		}{{Exact, tt.exact}, {Start, tt.start}, {End, tt.end}} {
+			if got := tt.tc.FrameToMs(tt.frame, c.ft); got != c.want {
+				t.Errorf("%s: FrameToMs(%d, %d) = %d, want %d",
+					tt.name, tt.frame, c.ft, got, c.want)
+			}
+		}
+		// the frame of the Start and End times is the same frame
+		for _, ft := range []FrameTime{Exact, Start, End} {
+			ms := tt.tc.FrameToMs(tt.frame, ft)
+			if got := tt.tc.MsToFrame(ms, ft); got != tt.frame {
+				t.Errorf("%s: MsToFrame(FrameToMs(%d, %d)) = %d",
+					tt.name, tt.frame, ft, got)
+			}
+		}
+	}
+}
+
+func TestSnap(t *testing.T) {
+	tc := NewTimecodes(FpsPal)
+	tests := []struct {
+		start, end int
+		want       [2]int
+	}{
+		{1000, 2000, [2]int{980, 1980}},
+		{990, 2010, [2]int{980, 2020}},
+		// not displayed in any frame
+		{1001, 1010, [2]int{1020, 1020}},
+	}
+	for _, tt := range tests {
+		s, e := tc.Snap(tt.start, tt.end)
+		if [2]int{s, e} != tt.want {
+			t.Errorf("Snap(%d, %d) = %d, %d, want %v",
+				tt.start, tt.end, s, e, tt.want)
+		}
+	}
+}
+
+func TestParseTimecodesError(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		msg  string
+	}{
+		{"empty", "", "asstime: empty timecodes file"},
+		{"unknown", "0\n40\n", `asstime: unknown timecodes format "0"`},
+		{"v2 time", "# timecode format v2\n0\nlater\n",
+			`asstime: timecodes line 3: invalid time "later"`},
+		{"v2 order", "# timecode format v2\n0\n40\n20\n",
+			"asstime: timecodes line 4: time out of order"},
+		{"v2 frames", "# timecode format v2\n0\n",
+			"asstime: timecodes need at least two frames"},
+		{"v2 duration", "# timecode format v2\n0\n0\n",
+			"asstime: timecodes have zero duration"},
+		{"v1 assume", "# timecode format v1\n0,10,30\n",
+			"asstime: timecodes v1 without Assume line"},
+		{"v1 rate", "# timecode format v1\nAssume 0\n",
+			"asstime: timecodes line 2: invalid frame rate"},
+		{"v1 range", "# timecode format v1\nAssume 25\n10,5,30\n",
+			`asstime: timecodes line 3: invalid range "10,5,30"`},
+		{"v1 fields", "# timecode format v1\nAssume 25\n10,30\n",
+			"asstime: timecodes line 3: expected start,end,fps"},
+		{"v1 overlap", "# timecode format v1\nAssume 25\n0,10,30\n10,20,60\n",
+			"asstime: timecodes ranges overlap"},
+	}
+	for _, tt := range tests {
+		_, err := ParseTimecodes(strings.NewReader(tt.src))
+		if err == nil || err.Error() != tt.msg {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.msg)
+		}
+	}
+}
@@ -9,7 +9,6 @@ import (
 	. "github.com/Alquimista/eyecandy/asstags"
 	"github.com/Alquimista/eyecandy/color"
 	"github.com/Alquimista/eyecandy/interpolate"
-	"github.com/Alquimista/eyecandy/utils"
 )
 
 const (
@@ -78,8 +77,8 @@ func doFX() {
 
 			// Efecto de entrada
 			s = subs.CopyChar(char) // *char
-			px := x + float64(utils.RandomInt(-5, 5))
-			py := y + float64(utils.RandomInt(-5, 5))
+			px := x + float64(line.Rand().RandomInt(-5, 5))
+			py := y + float64(line.Rand().RandomInt(-5, 5))
 			m := Move(px, py*iCustom[ci]-char.Height/4, x, y)
 			s.Tags = Blur(1) + Fade(150, 0) + C(c2.HTML()) + m + An(1)
 			s.StartTime = line.StartTime - 100
@@ -97,7 +96,9 @@ func doFX() {
 
 		}
 	}
-	subs.Save(ouputScript)
+	if err := subs.Save(ouputScript); err != nil {
+		panic(err)
+	}
 
 }
 
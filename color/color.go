@@ -392,19 +392,32 @@ func NewFromHTMLAlpha(hexc string, a uint8) *Color {
 	}
 }
 
-// NewFromHEXAlpha
+// NewFromSSA create a Color from an SSA color (&HAABBGGRR)
 func NewFromSSA(ssac string) *Color {
+	c, err := ParseSSA(ssac)
+	if err != nil {
+		return &Color{}
+	}
+	return c
+}
+
+// ParseSSA parse an SSA color (&HAABBGGRR), the alpha is optional
+func ParseSSA(ssac string) (*Color, error) {
 	// 0: match, 1: alpha, 2: blue, 3: green, 4: red
 	clr := reSSAColor.FindStringSubmatch(ssac)
-	if clr[0] == "" {
-		return &Color{}
+	if clr == nil || clr[0] == "" {
+		return nil, fmt.Errorf("color: invalid SSA color %q", ssac)
+	}
+	a := 0
+	if clr[1] != "" {
+		a = utils.Hex2int(clr[1])
 	}
 	return &Color{
 		R: uint8(utils.Hex2int(clr[4])),
 		G: uint8(utils.Hex2int(clr[3])),
 		B: uint8(utils.Hex2int(clr[2])),
-		A: uint8(utils.Hex2int(clr[1])),
-	}
+		A: uint8(a),
+	}, nil
 }
 
 func NewFromXYZ(x, y, z float64) *Color {
@@ -134,7 +134,11 @@ func DistinguishableColor(n, s, v int) (colors []*Color) {
 
 type rnd func() int
 
-// RandomColorHSV
+// RandomColorHSV a color with a random hue (RGoldenHue if f is nil),
+// the saturation s and the value v
+//
+// Deprecated: without f the hue come from the global source, reseeded
+// with the time. Use random.Rand.RandomColorHSV.
 func RandomColorHSV(s, v int, f rnd) *Color {
 	if f == nil {
 		f = RGoldenHue
@@ -142,6 +146,10 @@ func RandomColorHSV(s, v int, f rnd) *Color {
 	return NewFromHSV(f(), s, v)
 }
 
+// RGoldenHue a random hue, spread by the golden ratio
+//
+// Deprecated: the global source is reseeded with the time in every call.
+// Use random.Rand.RGoldenHue.
 func RGoldenHue() int {
 	rand.Seed(time.Now().UnixNano())
 	h := int(math.Mod(360*0.618033988749895*rand.Float64(), 360.0) + 0.5)
@@ -151,6 +159,10 @@ func RGoldenHue() int {
 	return h
 }
 
+// RHue a random hue between 1 and 360
+//
+// Deprecated: the global source is reseeded with the time in every call.
+// Use random.Rand.RHue.
 func RHue() int {
 	return utils.RandomInt(1, 360)
 }
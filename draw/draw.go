@@ -84,6 +84,12 @@ func (d Shape) String() string {
 	return d.draw
 }
 
+// Append add the commands of other Shape
+func (d Shape) Append(other *Shape) *Shape {
+	d.draw += other.draw
+	return &d
+}
+
 // NewScript create a new Script Struct with defaults
 func NewShape() *Shape {
 	return &Shape{}
@@ -251,8 +257,8 @@ func (d Shape) Translate(x, y int) *Shape {
 
 	move := func(m string) string {
 		pos := strings.Split(m, " ")
-		px := utils.Str2float(pos[0]) + float64(x)
-		py := utils.Str2float(pos[1]) + float64(y)
+		px := utils.Round(utils.Str2float(pos[0])+float64(x), 2)
+		py := utils.Round(utils.Str2float(pos[1])+float64(y), 2)
 		return fmt.Sprintf(`%g %g`, px, py)
 	}
 	d.draw = ShapeFilter(d.draw, move, "")
@@ -269,3 +275,18 @@ func (d Shape) Flip() *Shape {
 	d.draw = ShapeFilter(d.draw, flip, "")
 	return &d
 }
+
+// Rotate rotate the Shape around the origin, the angle in degrees
+// like \frz (counterclockwise on the screen)
+func (d Shape) Rotate(angle float64) *Shape {
+	sin, cos := math.Sincos(utils.Rad(angle))
+	rotate := func(m string) string {
+		pos := strings.Split(m, " ")
+		x, y := utils.Str2float(pos[0]), utils.Str2float(pos[1])
+		px := utils.Round(x*cos+y*sin, 2)
+		py := utils.Round(y*cos-x*sin, 2)
+		return fmt.Sprintf(`%g %g`, px, py)
+	}
+	d.draw = ShapeFilter(d.draw, rotate, "")
+	return &d
+}
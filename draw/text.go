@@ -0,0 +1,88 @@
+package draw
+
+import (
+	"fmt"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/Alquimista/eyecandy/utils"
+)
+
+// point a point of a glyph outline in pixels
+type point struct {
+	x, y float64
+}
+
+func (d *Shape) cmd(c string, pts ...point) {
+	d.draw += c + " "
+	for _, p := range pts {
+		d.draw += fmt.Sprintf(`%g %g `, utils.Round(p.x, 2), utils.Round(p.y, 2))
+	}
+}
+
+// Text convert a text into a Shape of the outlines of its glyphs,
+// measured like utils.Measure (scale in percent, spacing in pixels).
+// The origin (0, 0) is the top left corner of the text box, so drawn
+// with \an7\pos(Left,Top) it replace the text in place.
+// The quadratic curves of TrueType fonts are converted to cubic Bézier.
+func Text(ff font.Face, text string, scale [2]float64, spacing float64,
+	kerning bool) (*Shape, error) {
+
+	face, ok := ff.(*utils.Face)
+	if !ok || face.Font == nil {
+		return nil, fmt.Errorf("draw: font face without outlines")
+	}
+	sx, sy := scale[0]/100.0, scale[1]/100.0
+	px := func(p fixed.Point26_6, x float64) point {
+		return point{
+			(x + float64(p.X)/64) * sx,
+			(face.Ascent + float64(p.Y)/64) * sy,
+		}
+	}
+
+	d := NewShape()
+	var buf sfnt.Buffer
+	x := 0.0
+	prev := rune(-1)
+	for _, c := range text {
+		if kerning && prev >= 0 {
+			x += float64(ff.Kern(prev, c)) / 64
+		}
+		advance, _ := ff.GlyphAdvance(c)
+		gi, err := face.Font.GlyphIndex(&buf, c)
+		if err != nil {
+			return nil, fmt.Errorf("draw: %s", err)
+		}
+		segments, err := face.Font.LoadGlyph(&buf, gi, face.PPEM, nil)
+		if err != nil {
+			return nil, fmt.Errorf("draw: glyph %q: %s", c, err)
+		}
+		var cur point
+		for _, seg := range segments {
+			switch seg.Op {
+			case sfnt.SegmentOpMoveTo:
+				cur = px(seg.Args[0], x)
+				d.cmd("m", cur)
+			case sfnt.SegmentOpLineTo:
+				cur = px(seg.Args[0], x)
+				d.cmd("l", cur)
+			case sfnt.SegmentOpQuadTo:
+				// quadratic to cubic: the control points are
+				// 2/3 of the way to the quadratic control point
+				q, end := px(seg.Args[0], x), px(seg.Args[1], x)
+				c1 := point{cur.x + 2*(q.x-cur.x)/3, cur.y + 2*(q.y-cur.y)/3}
+				c2 := point{end.x + 2*(q.x-end.x)/3, end.y + 2*(q.y-end.y)/3}
+				d.cmd("b", c1, c2, end)
+				cur = end
+			case sfnt.SegmentOpCubeTo:
+				cur = px(seg.Args[2], x)
+				d.cmd("b", px(seg.Args[0], x), px(seg.Args[1], x), cur)
+			}
+		}
+		x += float64(advance)/64 + spacing
+		prev = c
+	}
+	return d, nil
+}
@@ -3,18 +3,23 @@ package eyecandy
 
 import (
 	"fmt"
+	"log"
 	"math"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"golang.org/x/image/font"
 
+	"github.com/Alquimista/eyecandy/asstags"
 	"github.com/Alquimista/eyecandy/asstime"
+	"github.com/Alquimista/eyecandy/draw"
+	"github.com/Alquimista/eyecandy/fontcache"
+	"github.com/Alquimista/eyecandy/random"
 	"github.com/Alquimista/eyecandy/reader"
 	"github.com/Alquimista/eyecandy/utils"
-
-	// "github.com/Alquimista/eyecandy/writer"
-	writer "github.com/Alquimista/eyecandy/writer2"
+	"github.com/Alquimista/eyecandy/writer"
 )
 
 const (
@@ -40,36 +45,78 @@ const (
 	AlignTopRight
 )
 
-var reStripTags = regexp.MustCompile(`({[\s\w\d\\-]+})*`)
 var reStripTags2 = regexp.MustCompile(`({[^k]+})*`)
 var reKara = regexp.MustCompile(
 	`{\\k[of]?(?P<duration>\d+)` + // k duration in centiseconds
 		`(?:\-)*(?P<inline>[\w\d]+)*` + // inline
 		`}(?P<text>[^\{\}]*)`) //text
 
+// StripSSATags remove the override blocks of a text,
+// the drawings are kept
 func StripSSATags(text string) string {
-	return strings.TrimSpace(reStripTags.ReplaceAllString(text, ""))
+	var b strings.Builder
+	for _, node := range asstags.Parse(text) {
+		if _, ok := node.(*asstags.Block); !ok {
+			b.WriteString(node.String())
+		}
+	}
+	return strings.TrimSpace(b.String())
 }
 
+// StripSSATagsNotKDur remove the override blocks without a k.
+//
+// Deprecated: use Line.Syls, it parse all the karaoke tags.
 func StripSSATagsNotKDur(text string) string {
 	return strings.TrimSpace(reStripTags2.ReplaceAllString(text, ""))
 }
 
+// GetSyls list the {\k} syllables of a text: the block, duration,
+// inline and text.
+//
+// Deprecated: use Line.Syls, it parse all the karaoke tags.
 func GetSyls(text string) [][]string {
 	return reKara.FindAllStringSubmatch(StripSSATagsNotKDur(text), -1)
 }
 
+// fontStyle get the font weight and italic of a Style
+func fontStyle(style *reader.Style) (weight int, italic bool) {
+	weight, italic = fontcache.WeightRegular, style.Italic
+	if style.Bold {
+		weight = fontcache.WeightBold
+	}
+	return weight, italic
+}
+
+// lineWrapStyle get the wrap style of a line: the script one
+// changed by the \q tags of the line
+func lineWrapStyle(text string, wrapStyle int) int {
+	for _, node := range asstags.Parse(text) {
+		block, ok := node.(*asstags.Block)
+		if !ok {
+			continue
+		}
+		for _, tag := range block.Tags {
+			if n, err := tag.Int(); tag.Name == "q" && err == nil &&
+				n >= WrapSmart && n <= WrapSmartLower {
+				wrapStyle = n
+			}
+		}
+	}
+	return wrapStyle
+}
+
 type Dialog struct {
 	Layer     int
-	StartTime int
-	EndTime   int
+	StartTime asstime.Time
+	EndTime   asstime.Time
 	StyleName string
 	Actor     string
+	Margin    [3]int // L, R, V (0 use the Style margin)
 	Effect    string
 	Text      string
 	Tags      string
-	Duration  int
-	MidTime   int
+	Duration  asstime.Time
+	MidTime   asstime.Time
 	Style     *reader.Style
 	Comment   bool
 	Width     float64
@@ -84,87 +131,232 @@ type Dialog struct {
 	Left      float64
 	Center    float64
 	Right     float64
+	// line number of the Dialogue or Comment in the input script,
+	// from 1 (0 in the generated dialogs)
+	ScriptLine int
 }
 
 // Line Represent the subtitle"s lines.
+// A Line rotated 270 degrees (the style Angle or \frz270) is vertical:
+// its rows run top to bottom and the positions of the Line, Syls and
+// Chars are rotated. Like the renderers a vertical font (@name) only turn
+// its CJK chars upright, a vertical Line need an Angle of 270 in its
+// style or \frz270 too.
 type Line struct {
 	Dialog
-	Kara       string
-	SylN       int
-	CharN      int
-	syls       [][]string
-	fontFace   font.Face
-	resolution [2]int
+	Kara      string
+	SylN      int
+	CharN     int
+	Rows      []*Row // rows of text, split by \N or wrapping
+	syls      []*karaSyl
+	layout    *layout
+	furi      []*furiPart
+	furiStyle *reader.Style
+	kerning   bool
+	seed      int64
+	rand      *random.Rand
+}
+
+// Seed get the random seed of the Line, from the Seed of the Script
+// and the index and start time of the Line
+func (d *Line) Seed() int64 {
+	return d.seed
+}
+
+// Rand get the random source of the Line, seeded with its Seed:
+// the same Line get the same random numbers in every run
+func (d *Line) Rand() *random.Rand {
+	if d.rand == nil {
+		d.rand = random.New(d.seed)
+	}
+	return d.rand
+}
+
+// lineSeed mix the seed of the Script with the index and the start time
+// of a Line (splitmix64), the near lines get unrelated seeds
+func lineSeed(seed int64, index int, start asstime.Time) int64 {
+	x := uint64(seed) ^ uint64(index+1)*0x9e3779b97f4a7c15 ^
+		uint64(start)*0xbf58476d1ce4e5b9
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return int64(x)
 }
 
 // Syl Represent the subtitle"s lines.
 type Syl struct {
 	Dialog
-	Inline string
+	Inline    string
+	Kind      string // karaoke tag: KaraNormal, KaraFill, KaraOutline...
+	Override  string // the other override tags of the syllable
+	PreText   bool   // the text before the first karaoke tag
+	PreSpace  string // the spaces before and after the text
+	PostSpace string
+	Index     int // of the karaoke syllable in the Line, from 0 (see Syls)
+	line      *Line
+	first     int // index of the first and last char in the Line layout
+	last      int
 }
 
 // Char Represent the subtitle"s lines.
 type Char struct {
 	Dialog
 	Inline        string
-	SylStartTime  int
-	SylEndTime    int
-	SylMidEndTime int
-	SylDuration   int
+	SylStartTime  asstime.Time
+	SylEndTime    asstime.Time
+	SylMidEndTime asstime.Time
+	SylDuration   asstime.Time
+	SylIndex      int // of its syllable in Line.Syls(), from 0
+	line          *Line
+	glyph         int // index of the char in the Line layout
+}
+
+// rowShape convert the chars [first, last] of a row into a vector
+// drawing, each run of chars with its font. The origin is the top left
+// corner of the first char in the row, before the rotation of a
+// vertical Line.
+func (d *Line) rowShape(first, last int) (*draw.Shape, error) {
+	glyphs := d.layout.glyphs
+	shape := draw.NewShape()
+	for i := first; i <= last; {
+		g := glyphs[i]
+		if g.newline || g.hidden {
+			i++
+			continue
+		}
+		var text []rune
+		j := i
+		for ; j <= last && glyphs[j].span == g.span &&
+			!glyphs[j].newline && !glyphs[j].hidden; j++ {
+			text = append(text, drawnChar(glyphs[j].char))
+		}
+		s, err := g.span.shape(string(text), d.kerning)
+		if err != nil {
+			return nil, err
+		}
+		shape = shape.Append(s.Translate(int(math.Round(g.x-glyphs[first].x)),
+			int(math.Round(d.layout.baseline(g)))))
+		i = j
+	}
+	return shape, nil
+}
+
+// glyphsShape convert the chars [first, last] of a row into a vector
+// drawing on the screen, the origin is the top left corner
+func (d *Line) glyphsShape(first, last int) (*draw.Shape, error) {
+	shape, err := d.rowShape(first, last)
+	if err != nil {
+		return nil, err
+	}
+	row := d.layout.rows[d.layout.glyphs[first].row]
+	return d.layout.rotateShape(shape, row.Height), nil
+}
+
+// Shape convert the text of the Line into a vector drawing,
+// drawn with \an7\pos(Left,Top) it replace the text in place
+func (d *Line) Shape() (*draw.Shape, error) {
+	shape := draw.NewShape()
+	glyphs := d.layout.glyphs
+	left, top, _, bottom := d.layout.bounds()
+	for r, row := range d.layout.rows {
+		first, last := -1, -1
+		for i, g := range glyphs {
+			if g.row == r && !g.newline && !g.hidden {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first < 0 {
+			continue
+		}
+		s, err := d.rowShape(first, last)
+		if err != nil {
+			return nil, err
+		}
+		shape = shape.Append(s.Translate(
+			int(math.Round(row.Left+glyphs[first].x-left)),
+			int(math.Round(row.Top-top))))
+	}
+	return d.layout.rotateShape(shape, bottom-top), nil
+}
+
+// sylText the visible chars [first, last] of a row
+func (d *Line) sylText(first, last int) string {
+	var text []rune
+	for _, g := range d.layout.glyphs[first : last+1] {
+		if !g.newline {
+			text = append(text, g.char)
+		}
+	}
+	return string(text)
+}
+
+// Shape convert the text of the Syl into a vector drawing,
+// drawn with \an7\pos(Left,Top) it replace the text in place
+func (s *Syl) Shape() (*draw.Shape, error) {
+	return s.line.glyphsShape(s.first, s.last)
+}
+
+// Shape convert the Char into a vector drawing,
+// drawn with \an7\pos(Left,Top) it replace the text in place
+func (c *Char) Shape() (*draw.Shape, error) {
+	return c.line.glyphsShape(c.glyph, c.glyph)
 }
 
 // Chars list all characters in a Line
 func (d *Line) Chars() (chars []*Char) {
 
-	start, end, x, dur := 0, 0, 0.0, 0
-	for _, s := range d.Syls() {
-
-		curX := float64(s.Left)
-		lineStart := s.StartTime
-		lineEnd := s.EndTime
+	syls := d.syllables()
+	// the chars of the rows of a broken syllable share its duration
+	charN := make(map[int]int)
+	for _, s := range syls {
+		charN[s.Index] += utils.LenString(s.Text)
+	}
 
-		charN := utils.LenString(s.Text)
+	var start, end, dur asstime.Time
+	i := 0 // index of the char in its syllable
+	for si, s := range syls {
+		if si == 0 || s.Index != syls[si-1].Index {
+			i = 0
+		}
+		first := d.layout.glyphs[s.first]
+		n := charN[s.Index]
 
 		// For syls of one char
-		if charN == 1 || charN == 0 {
+		if n == 1 || n == 0 {
 			dur = s.Duration
 		} else {
-			dur = int(s.Duration / charN)
+			dur = s.Duration / asstime.Time(n)
 		}
 
-		for i, c := range s.Text {
-			text := string(c)
-
-			start = lineStart
-			lineStart += dur
-
-			width, _ := utils.MeasureString(d.fontFace, text)
-			width *= d.Style.Scale[0] / 100.0
-			// width += 2.0*s.Style.Bord + s.Style.Shadow
-			middlewidth := float64(width) / 2.0
+		for gi := s.first; gi <= s.last; gi++ {
+			g := d.layout.glyphs[gi]
+			if g.newline {
+				continue
+			}
+			text := string(g.char)
 
-			cleft := float64(curX)
-			ccenter := cleft + float64(middlewidth)
-			cright := cleft + float64(width)
+			start = s.StartTime + dur*asstime.Time(i)
 
-			align := d.Style.Alignment
+			width := g.width
+			cleft := s.Left + g.x - first.x
+			ccenter := cleft + width/2.0
+			cright := cleft + width
+			x, _ := alignPoint(d.Style.Alignment, cleft, ccenter, cright,
+				s.Top, s.Middle, s.Bottom)
 
-			switch align {
-			case 1, 4, 7: // left
-				x = cleft
-			case 2, 5, 8: // center
-				x = ccenter
-			case 3, 6, 9: // right
-				x = cright
-			}
-
-			if i == charN-1 {
+			if i == n-1 {
 				// Ensure that the end time and the width of the last char
 				// is the same that the end time and width of the syl
-				end = lineEnd
+				end = s.EndTime
 			} else {
-				end = lineStart
+				end = start + dur
 			}
+			i++
 
 			c := &Char{
 				Dialog: Dialog{
@@ -172,6 +364,7 @@ func (d *Line) Chars() (chars []*Char) {
 					Style:     d.Style,
 					StyleName: d.StyleName,
 					Actor:     d.Actor,
+					Margin:    d.Margin,
 					Effect:    d.Effect,
 					Tags:      d.Tags,
 					Comment:   d.Comment,
@@ -180,147 +373,99 @@ func (d *Line) Chars() (chars []*Char) {
 					Duration:  dur,
 					MidTime:   end - start,
 					Text:      text,
-					Width:     float64(width),
-					Height:    d.Height, //+ 2.0*d.Style.Bord + d.Style.Shadow,
-					Size:      [2]float64{float64(width), d.Height},
-					X:         float64(x),
-					Y:         float64(d.Y),
-					Top:       float64(d.Top),
-					Middle:    float64(d.Middle),
-					Bottom:    float64(d.Bottom),
-					Left:      float64(cleft),
-					Center:    float64(ccenter),
-					Right:     float64(cright),
+					Width:     width,
+					Height:    s.Height,
+					Size:      [2]float64{width, s.Height},
+					X:         x,
+					Y:         s.Y,
+					Top:       s.Top,
+					Middle:    s.Middle,
+					Bottom:    s.Bottom,
+					Left:      cleft,
+					Center:    ccenter,
+					Right:     cright,
 				},
 				Inline:        s.Inline,
 				SylStartTime:  s.StartTime,
 				SylEndTime:    s.EndTime,
 				SylMidEndTime: s.MidTime,
 				SylDuration:   s.Duration,
+				SylIndex:      si,
+				line:          d,
+				glyph:         gi,
 			}
+			d.layout.orient(&c.Dialog)
 
 			chars = append(chars, c)
-
-			curX += width
 		}
 	}
 	return chars
 
 }
 
-// Syls list all syllables in a Line
+// Syls list all syllables in a Line, the syllables without visible
+// chars are skipped (but counted by the Index of the next ones).
+// A syllable broken by \N or by the wrapping is split in a Syl for
+// every row, with the times and the Index of the syllable.
+// The syllables of a vertical Line run top to bottom.
 func (d *Line) Syls() (syls []*Syl) {
+	syls = d.syllables()
+	for _, s := range syls {
+		d.layout.orient(&s.Dialog)
+	}
+	return syls
+}
+
+// syllables list the syllables in the rows, before the rotation
+// of a vertical Line
+func (d *Line) syllables() (syls []*Syl) {
 
 	lineStart := d.StartTime
 	lineEnd := d.EndTime
-	end := 0
-	fontFace := d.fontFace
-
-	spaceWidth, _ := utils.MeasureString(fontFace, " ")
-	spaceWidth *= d.Style.Scale[0] / 100.0
-	//spaceWidth += 2*d.Style.Bord + d.Style.Shadow
+	end := asstime.Time(0)
 
-	curX := d.Left + float64(d.SylN)*-d.XFix/2.0
-	maxWidth := 0.0
-	sumHeight := 0.0
-	resx, resy := float64(d.resolution[0]), float64(d.resolution[1])
-
-	for i, dlg := range d.syls {
-		duration, inline, text := dlg[1], dlg[2], dlg[3]
-		dur := utils.Str2int(duration) * 10 // cs to ms
+	for i, ks := range d.syls {
+		dur := ks.duration
 
 		// Absolute times
-		start := lineStart
-		lineStart += dur
+		start := lineStart + ks.start
 		if i == d.SylN-1 {
 			// Ensure that the end time and the width of the last syl
 			// is the same that the end time and width of the line
 			end = lineEnd
 		} else {
-			end = lineStart
+			end = start + dur
 		}
 
-		strippedText, preSpace, postSpace := utils.TrimSpaceCount(text)
-
-		width, _ := utils.MeasureString(fontFace, strippedText)
-		width *= d.Style.Scale[0] / 100.0
-		//width += 2.0*d.Style.Bord + d.Style.Shadow
-		height := d.Height
-
-		middleheight := float64(height) / 2.0
-		middlewidth := float64(width) / 2.0
-		align := d.Style.Alignment
-
-		curX += float64(preSpace) * spaceWidth
-		sleft := float64(curX)
-		scenter := sleft + middlewidth
-		sright := sleft + width
-		x := 0.0
-		y := 0.0
-		stop := 0.0
-		smid := 0.0
-		sbot := 0.0
-
-		maxWidth = math.Max(maxWidth, width)
-		sumHeight += height
-
-		// line x
-		if align > 6 || align < 4 {
-			switch align {
-			case 1, 7: // left
-				x = sleft
-			case 2, 8: // center
-				x = scenter
-			case 3, 9: // right
-				x = sright
-			}
-			curX += width + float64(postSpace)*spaceWidth +
-				float64(d.Style.Spacing) + d.XFix
-
-		} else { // vertical alignment
-			xFix := (maxWidth - width) / 2.0
-			switch align {
-			case 4: // left
-				sleft = d.Left + xFix
-				scenter = sleft + middlewidth
-				sright = sleft + width
-				x = sleft
-			case 5: // center
-				sleft = resx/2.0 - middlewidth
-				scenter = sleft + middlewidth
-				sright = sleft + width
-				x = scenter
-			case 6: // right
-				sleft = d.Right - width - xFix
-				scenter = sleft + middlewidth
-				sright = sleft + width
-				x = sright
-			}
-		}
+		// a syllable broken in rows give a Syl in every row
+		spans := d.layout.spans(i)
+		for j, span := range spans {
+			first, last := span[0], span[1]
+			g := d.layout.glyphs[first]
+			row := d.layout.rows[g.row]
 
-		curY := resy/2.0 - sumHeight/2.0 + float64(d.Style.Spacing)
-
-		// line y
-		if align > 6 || align < 4 {
-			stop = d.Top
-			smid = d.Middle
-			sbot = d.Bottom
-			y = d.Y
-		} else { // vertical alignment
-			stop = curY
-			smid = stop + middleheight
-			sbot = stop + height
-			y = smid
-			// curY += height
-		}
+			width := d.layout.glyphs[last].x + d.layout.glyphs[last].width - g.x
+			height := row.Height
+
+			middlewidth := width / 2.0
+			align := d.Style.Alignment
+
+			sleft := row.Left + g.x + (float64(i)-float64(d.SylN)/2.0)*d.XFix
+			scenter := sleft + middlewidth
+			sright := sleft + width
+			stop := row.Top
+			smid := row.Middle
+			sbot := row.Bottom
+
+			x, y := alignPoint(align, sleft, scenter, sright, stop, smid, sbot)
 
-		if text != "" {
 			s := &Syl{
 				Dialog: Dialog{
 					Layer:     d.Layer,
 					Style:     d.Style,
 					StyleName: d.StyleName,
 					Actor:     d.Actor,
+					Margin:    d.Margin,
 					Effect:    d.Effect,
 					Tags:      d.Tags,
 					Comment:   d.Comment,
@@ -328,22 +473,36 @@ func (d *Line) Syls() (syls []*Syl) {
 					EndTime:   end,
 					Duration:  dur,
 					MidTime:   end - start,
-					Text:      strippedText,
-					Width:     float64(width),
-					Height:    float64(height),
-					Size:      [2]float64{float64(width), float64(height)},
-					X:         float64(x),
-					Y:         float64(y),
-					Top:       float64(stop),
-					Middle:    float64(smid),
-					Bottom:    float64(sbot),
-					Left:      float64(sleft),
-					Center:    float64(scenter),
-					Right:     float64(sright),
+					Text:      d.sylText(first, last),
+					Width:     width,
+					Height:    height,
+					Size:      [2]float64{width, height},
+					X:         x,
+					Y:         y,
+					Top:       stop,
+					Middle:    smid,
+					Bottom:    sbot,
+					Left:      sleft,
+					Center:    scenter,
+					Right:     sright,
 				},
-				Inline: inline,
+				Inline:   ks.inline,
+				Kind:     ks.kind,
+				Override: ks.override,
+				PreText:  ks.preText,
+				Index:    i,
+				line:     d,
+				first:    first,
+				last:     last,
 			}
 
+			if j == 0 {
+				trim := strings.TrimLeft(ks.text, " ")
+				s.PreSpace = ks.text[:len(ks.text)-len(trim)]
+			}
+			if j == len(spans)-1 {
+				s.PostSpace = ks.text[len(strings.TrimRight(ks.text, " ")):]
+			}
 			syls = append(syls, s)
 		}
 	}
@@ -364,11 +523,105 @@ type Script struct {
 	MetaTiming         string
 	Audio              string
 	LineN              int
-	Shift              int
+	Shift              asstime.Time
 	XFix               float64
+	Timecodes          *asstime.Timecodes // snap the added lines to frames
+	Kerning            bool               // use the kerning pairs of the fonts
+	WrapStyle          int                // wrapping of the lines (WrapSmart...)
+	FuriScale          float64            // size of the furigana (DefaultFuriScale)
+	Seed               int64              // of the random sources, see Rand
 	scriptIn           *reader.Script
 	scriptOut          *writer.Script
-	fontFace           map[string]font.Face
+	fontFace           map[faceKey]font.Face
+	fontErr            map[faceKey]error // the missing fonts
+	furiStyles         map[string]*reader.Style
+	rand               *random.Rand
+	stream             *writer.Stream
+	mu                 sync.Mutex // guard the output of Add
+}
+
+// Rand get the random source of the Script, seeded with Seed the first
+// time. The lines have their own source (Line.Rand), independent of the
+// order in which they are processed.
+func (fx *Script) Rand() *random.Rand {
+	if fx.rand == nil {
+		fx.rand = random.New(fx.Seed)
+	}
+	return fx.rand
+}
+
+// faceKey a font face with the size, weight and italic in effect
+type faceKey struct {
+	name   string
+	size   float64
+	weight int
+	italic bool
+}
+
+// face get a font face, loading it the first time.
+// A missing font is logged once.
+func (fx *Script) face(name string, size float64, weight int,
+	italic bool) (font.Face, error) {
+	key := faceKey{strings.ToLower(name), size, weight, italic}
+	if ff, ok := fx.fontFace[key]; ok {
+		return ff, nil
+	}
+	if err, ok := fx.fontErr[key]; ok {
+		return nil, err
+	}
+	ff, err := utils.LoadFontStyle(name, size, weight, italic)
+	if err != nil {
+		log.Printf("eyecandy: %s", err)
+		fx.fontErr[key] = err
+		return nil, err
+	}
+	fx.fontFace[key] = ff
+	return ff, nil
+}
+
+// furiStyle get the furigana style of a Style,
+// adding it to the script the first time
+func (fx *Script) furiStyle(style *reader.Style) *reader.Style {
+	if furi, ok := fx.furiStyles[style.Name]; ok {
+		return furi
+	}
+	furi := furiStyle(style, fx.FuriScale)
+	fx.furiStyles[style.Name] = furi
+	fx.scriptIn.StyleUsed[furi.Name] = furi
+	fx.scriptOut.AddStyle(writerStyle(furi))
+	return furi
+}
+
+// style get a Style of the input script by name, for the \r tags
+func (fx *Script) style(name string) (*reader.Style, bool) {
+	style, ok := fx.scriptIn.Style[name]
+	return style, ok
+}
+
+// Commented list the commented lines in a Script, like the karaoke
+// templates. They aren't laid out.
+func (fx *Script) Commented() (dialogs []*Dialog) {
+	for _, dlg := range fx.scriptIn.Dialog.Commented() {
+		duration := dlg.EndTime - dlg.StartTime
+		dialogs = append(dialogs, &Dialog{
+			Layer:     dlg.Layer,
+			StartTime: dlg.StartTime,
+			EndTime:   dlg.EndTime,
+			Duration:  duration,
+			MidTime:   dlg.StartTime + duration/2,
+			Style:     dlg.Style,
+			StyleName: dlg.StyleName,
+			Actor:     dlg.Actor,
+			Margin:    dlg.Margin,
+			Effect:    dlg.Effect,
+			Text:      dlg.Text,
+			Tags:      dlg.Tags,
+			Comment:   dlg.Comment,
+
+			ScriptLine: dlg.Line,
+		})
+	}
+	return dialogs
 }
 
 // Lines List all the lines in a Script
@@ -376,79 +629,65 @@ func (fx *Script) Lines() (dialogs []*Line) {
 
 	resx, resy := float64(fx.Resolution[0]), float64(fx.Resolution[1])
 
-	for _, dlg := range fx.scriptIn.Dialog.NotCommented() {
+	for n, dlg := range fx.scriptIn.Dialog.NotCommented() {
 
-		end := asstime.SSAtoMS(dlg.EndTime)
-		start := asstime.SSAtoMS(dlg.StartTime)
+		end := dlg.EndTime
+		start := dlg.StartTime
 		duration := end - start
-		text := StripSSATags(dlg.Text)
-		fontFace := fx.fontFace[dlg.StyleName]
-		width, height := utils.MeasureString(fontFace, text)
-		width *= dlg.Style.Scale[0] / 100.0
-		//width += 2*dlg.Style.Bord + dlg.Style.Shadow
-		height *= dlg.Style.Scale[1] / 100.0
 
 		align := dlg.Style.Alignment
-		ml, mr, mv := float64(dlg.Style.Margin[0]),
-			float64(dlg.Style.Margin[1]),
-			float64(dlg.Style.Margin[2])
-
-		// Alignment
-		middleheight := float64(height) / 2.0
-		middlewidth := float64(width) / 2.0
-
-		x := 0.0
-		y := 0.0
-		ltop := 0.0
-		lmid := 0.0
-		lbot := 0.0
-		lleft := 0.0
-		lcenter := 0.0
-		lright := 0.0
-
-		// line x
-		switch align {
-		case 1, 4, 7: // left
-			lleft = ml
-			lcenter = lleft + middlewidth
-			lright = lleft + width
-			x = lleft
-		case 2, 5, 8: // center
-			lleft = resx/2.0 - middlewidth
-			lcenter = lleft + middlewidth
-			lright = lleft + width
-			x = lcenter
-		case 3, 6, 9: // right
-			lleft = resx - mr - width
-			lcenter = lleft + middlewidth
-			lright = lleft + width
-			x = lright
+		margin := dlg.Margin
+		for i, m := range margin {
+			// A zero margin in the line use the style margin
+			if m == 0 {
+				margin[i] = dlg.Style.Margin[i]
+			}
+		}
+		ml, mr, mv := float64(margin[0]),
+			float64(margin[1]),
+			float64(margin[2])
+
+		// Split the text in rows with the style of every span of text,
+		// and align them
+		pieces, syls := splitPieces(dlg.Text)
+		lay, err := newLayout(pieces, dlg.Style, fx, fx.Kerning,
+			lineWrapStyle(dlg.Text, fx.WrapStyle), resx-ml-mr)
+		if err != nil {
+			log.Printf("eyecandy: line %d: %s, skipping the line",
+				dlg.Line, err)
+			continue
+		}
+		lay.place(align, resx, resy, ml, mr, mv)
+
+		// the text without the tags and the furigana
+		text := ""
+		for _, p := range pieces {
+			text += p.text
 		}
 
-		// line y
-		switch align {
-		case 7, 8, 9: // top
-			ltop = mv
-			lmid = ltop + middleheight
-			lbot = ltop + height
-			y = ltop
-		case 4, 5, 6: // middle
-			lmid = resy / 2
-			ltop = lmid - middleheight
-			lbot = lmid + middleheight
-			y = lmid
-		case 1, 2, 3: // bottom
-			lbot = resy - mv
-			lmid = lbot - middleheight
-			ltop = lbot - height
-			y = lbot
+		var furi []*furiPart
+		var fstyle *reader.Style
+		for _, s := range syls {
+			if s.furi != "" {
+				furi = layoutFuri(lay, syls, fx, fx.FuriScale, fx.Kerning)
+				fstyle = fx.furiStyle(dlg.Style)
+				break
+			}
 		}
 
-		syls := GetSyls(dlg.Text)
+		lleft, ltop, lright, lbot := lay.bounds()
+		width, height := lright-lleft, lbot-ltop
+		lcenter := lleft + width/2.0
+		lmid := ltop + height/2.0
+		x, y := alignPoint(align, lleft, lcenter, lright, ltop, lmid, lbot)
+
+		// a vertical Line is rotated around its position
+		lay.vertical = lineVertical(dlg.Style, dlg.Text)
+		lay.ox, lay.oy = x, y
 
 		charN := 0
 		for _, s := range syls {
-			syltext := strings.TrimSpace(s[3])
+			syltext := strings.TrimSpace(s.text)
 			if syltext != "" {
 				for range syltext {
 					charN++
@@ -462,10 +701,11 @@ func (fx *Script) Lines() (dialogs []*Line) {
 				StartTime: start,
 				EndTime:   end,
 				Duration:  duration,
-				MidTime:   start + int(duration/2),
+				MidTime:   start + duration/2,
 				Style:     dlg.Style,
 				StyleName: dlg.StyleName,
 				Actor:     dlg.Actor,
+				Margin:    dlg.Margin,
 				Effect:    dlg.Effect,
 				Text:      text,
 				Tags:      dlg.Tags,
@@ -482,14 +722,21 @@ func (fx *Script) Lines() (dialogs []*Line) {
 				Left:      float64(lleft),
 				Center:    float64(lcenter),
 				Right:     float64(lright),
+
+				ScriptLine: dlg.Line,
 			},
-			Kara:       dlg.Text,
-			SylN:       len(syls),
-			CharN:      charN,
-			syls:       syls,
-			fontFace:   fontFace,
-			resolution: fx.Resolution,
+			Kara:      dlg.Text,
+			SylN:      len(syls),
+			CharN:     charN,
+			Rows:      lay.screenRows(),
+			syls:      syls,
+			layout:    lay,
+			furi:      furi,
+			furiStyle: fstyle,
+			kerning:   fx.Kerning,
+			seed:      lineSeed(fx.Seed, n, start),
 		}
+		lay.orient(&d.Dialog)
 		dialogs = append(dialogs, d)
 	}
 	return dialogs
@@ -527,51 +774,87 @@ func (fx *Script) CopyChar(dialog *Char) Char {
 	return *dialog
 }
 
+// CopyWord create a copy of the current Word
+func (fx *Script) CopyWord(dialog *Word) Word {
+	return *dialog
+}
+
+// CopyFuri create a copy of the current Furi
+func (fx *Script) CopyFuri(dialog *Furi) Furi {
+	return *dialog
+}
+
+// dialogTimes get the output times of a Dialog, shifted and
+// snapped to the video frames when the Script has Timecodes
+func (fx *Script) dialogTimes(start, end asstime.Time) (
+	asstime.Time, asstime.Time) {
+	start, end = start+fx.Shift, end+fx.Shift
+	if fx.Timecodes != nil {
+		s, e := fx.Timecodes.Snap(start.MS(), end.MS())
+		start, end = asstime.Time(s), asstime.Time(e)
+	}
+	return start.Positive(), end.Positive()
+}
+
 // Add append a Dialog (Syl, Char, Line) to Script
 func (fx *Script) Add(dialog interface{}) {
+	d := fx.writerDialog(dialog)
+	if d == nil {
+		fmt.Println("Not admitted object")
+		return
+	}
+	fx.addDialog(d)
+}
 
-	switch dlg := dialog.(type) {
+// addDialog append an output Dialog, or write it if the Script is streamed
+func (fx *Script) addDialog(d *writer.Dialog) {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	if fx.stream != nil {
+		// the errors are returned by Close
+		fx.stream.AddDialog(d)
+		return
+	}
+	fx.scriptOut.AddDialog(d)
+}
+
+// writerDialog convert a Dialog (Syl, Char, Line...) to an output Dialog,
+// nil if it isn't admitted
+func (fx *Script) writerDialog(dialog interface{}) *writer.Dialog {
+	var dlg *Dialog
+	switch v := dialog.(type) {
 	case Line:
-		d := NewDialog(dlg.Text)
-		d.Layer = dlg.Layer
-		d.Start = asstime.MStoSSA(dlg.StartTime + fx.Shift)
-		d.End = asstime.MStoSSA(dlg.EndTime + fx.Shift)
-		d.StyleName = dlg.StyleName
-		d.Actor = dlg.Actor
-		d.Effect = dlg.Effect
-		d.Tags = dlg.Tags
-		d.Comment = dlg.Comment
-		fx.scriptOut.AddDialog(d)
+		dlg = &v.Dialog
 	case Syl:
-		d := NewDialog(dlg.Text)
-		d.Layer = dlg.Layer
-		d.Start = asstime.MStoSSA(dlg.StartTime + fx.Shift)
-		d.End = asstime.MStoSSA(dlg.EndTime + fx.Shift)
-		d.StyleName = dlg.StyleName
-		d.Actor = dlg.Actor
-		d.Effect = dlg.Effect
-		d.Tags = dlg.Tags
-		d.Comment = dlg.Comment
-		fx.scriptOut.AddDialog(d)
+		dlg = &v.Dialog
 	case Char:
-		d := NewDialog(dlg.Text)
-		d.Layer = dlg.Layer
-		d.Start = asstime.MStoSSA(dlg.StartTime + fx.Shift)
-		d.End = asstime.MStoSSA(dlg.EndTime + fx.Shift)
-		d.StyleName = dlg.StyleName
-		d.Actor = dlg.Actor
-		d.Effect = dlg.Effect
-		d.Tags = dlg.Tags
-		d.Comment = dlg.Comment
-		fx.scriptOut.AddDialog(d)
+		dlg = &v.Dialog
+	case Word:
+		dlg = &v.Dialog
+	case Furi:
+		dlg = &v.Dialog
 	default:
-		fmt.Println("Not admitted object")
+		return nil
 	}
+	d := NewDialog(dlg.Text)
+	d.Layer = dlg.Layer
+	d.Start, d.End = fx.dialogTimes(dlg.StartTime, dlg.EndTime)
+	d.StyleName = dlg.StyleName
+	d.Actor = dlg.Actor
+	d.Margin = dlg.Margin
+	d.Effect = dlg.Effect
+	d.Tags = dlg.Tags
+	d.Comment = dlg.Comment
+	return d
+}
 
+// AttachFont embed a font file in the [Fonts] section of the output
+func (fx *Script) AttachFont(fn string) error {
+	return fx.scriptOut.AttachFont(fn)
 }
 
-// Save create the final script file (.ass)
-func (fx *Script) Save(fn string) {
+// output get the output script with the metadata of the Script
+func (fx *Script) output() *writer.Script {
 	fx.scriptOut.Resolution = fx.Resolution
 	fx.scriptOut.VideoPath = fx.VideoPath
 	fx.scriptOut.VideoZoom = fx.VideoZoom
@@ -583,39 +866,129 @@ func (fx *Script) Save(fn string) {
 	fx.scriptOut.MetaTranslation = fx.MetaTranslation
 	fx.scriptOut.MetaTiming = fx.MetaTiming
 	fx.scriptOut.Audio = fx.Audio
-	fx.scriptOut.Save(fn)
+	return fx.scriptOut
+}
+
+// Save create the final script file (.ass)
+func (fx *Script) Save(fn string) error {
+	return fx.output().Save(fn)
+}
+
+// Stream start writing the script file fn (.ass, or .ass.gz compressed
+// with gzip) with the headers and the styles, then the dialogs are
+// written as they are added instead of being kept until Save. The styles
+// and the metadata can't change after, Close end the file.
+func (fx *Script) Stream(fn string) error {
+	// the furigana styles are added when the lines are laid out
+	for _, dlg := range fx.scriptIn.Dialog.NotCommented() {
+		_, syls := splitPieces(dlg.Text)
+		for _, s := range syls {
+			if s.furi != "" {
+				fx.furiStyle(dlg.Style)
+				break
+			}
+		}
+	}
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	if fx.stream != nil {
+		return fmt.Errorf("eyecandy: the script is already streamed")
+	}
+	stream, err := writer.CreateStream(fn, fx.output())
+	if err != nil {
+		return err
+	}
+	fx.scriptOut.Dialog = nil
+	fx.stream = stream
+	return nil
+}
+
+// Close end the script file started by Stream,
+// with the attached fonts
+func (fx *Script) Close() error {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	if fx.stream == nil {
+		return nil
+	}
+	err := fx.stream.Close()
+	fx.stream = nil
+	return err
 }
 
-// NewEffect create a new script
+// NewEffect create a new script, it panics if the script can't be read
+// or a font of the styles is missing (see NewEffectErr)
 func NewEffect(inFN string) *Script {
-	input := reader.Read(inFN)
+	fx, err := NewEffectErr(inFN)
+	if err != nil {
+		panic(err)
+	}
+	return fx
+}
+
+// NewEffectErr create a new script. The fonts of the used styles are
+// loaded, a missing font return a *fontcache.NotFoundError.
+func NewEffectErr(inFN string) (*Script, error) {
+	input, err := reader.ReadFile(inFN)
+	if err != nil {
+		return nil, err
+	}
 	output := writer.NewScript()
 
-	fontFace := make(map[string]font.Face)
+	// Keep the metadata, attachments and extradata of the input script
+	output.Comments = input.Comments
+	for _, f := range input.Info {
+		output.Info = append(output.Info, writer.Field{Key: f.Key, Value: f.Value})
+	}
+	for _, f := range input.Garbage {
+		output.Garbage = append(output.Garbage,
+			writer.Field{Key: f.Key, Value: f.Value})
+	}
+	for _, sec := range input.Sections {
+		output.Sections = append(output.Sections,
+			&writer.Section{Name: sec.Name, Lines: sec.Lines})
+	}
+
+	// The fonts embedded in the script are used before the system fonts
+	for _, att := range input.Fonts {
+		if err := fontcache.Default.AddFont(att.Name, att.Data); err != nil {
+			log.Printf("eyecandy: skipping embedded font: %s", err)
+		}
+	}
+
+	fontFace := make(map[faceKey]font.Face)
+
+	// libass use the kerning pairs with "Kerning: yes"
+	kerning := false
+	for _, f := range input.Info {
+		if strings.EqualFold(f.Key, "Kerning") {
+			kerning = strings.EqualFold(f.Value, "yes")
+		}
+	}
+
+	// the lines are wrapped like the renderers, smart wrapping by default
+	wrapStyle := WrapSmart
+	for _, f := range input.Info {
+		if strings.EqualFold(f.Key, "WrapStyle") {
+			if n, err := strconv.Atoi(f.Value); err == nil {
+				wrapStyle = n
+			}
+		}
+	}
 
 	ssampling := 1
 
 	for _, style := range input.StyleUsed {
-		s := NewStyle(style.Name)
-		s.Name = style.Name
-		s.FontName = style.FontName
-		s.FontSize = style.FontSize
-		s.Color = style.Color
-		s.Bold = style.Bold
-		s.Italic = style.Italic
-		s.Scale = style.Scale
-		s.Angle = style.Angle
-		s.Bord = style.Bord
-		s.Shadow = style.Shadow
-		s.Alignment = style.Alignment
-		s.Margin = style.Margin
+		s := writerStyle(style)
 		output.AddStyle(s)
 
-		ff, err := utils.LoadFont(s.FontName, s.FontSize*ssampling)
+		weight, italic := fontStyle(style)
+		size := float64(s.FontSize * ssampling)
+		ff, err := utils.LoadFontStyle(s.FontName, size, weight, italic)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		fontFace[s.Name] = ff
+		fontFace[faceKey{strings.ToLower(s.FontName), size, weight, italic}] = ff
 	}
 
 	// Add the original karaoke commented by default in the script
@@ -632,6 +1005,7 @@ func NewEffect(inFN string) *Script {
 		d.End = dlg.EndTime
 		d.StyleName = dlg.StyleName
 		d.Actor = dlg.Actor
+		d.Margin = dlg.Margin
 		d.Effect = dlg.Effect
 		d.Comment = true
 		output.AddDialog(d)
@@ -654,10 +1028,38 @@ func NewEffect(inFN string) *Script {
 		MetaTiming:         input.MetaTiming,
 		Audio:              input.Audio,
 		LineN:              LineN,
+		Kerning:            kerning,
+		FuriScale:          DefaultFuriScale,
+		WrapStyle:          wrapStyle,
 		fontFace:           fontFace,
+		fontErr:            make(map[faceKey]error),
+		furiStyles:         make(map[string]*reader.Style),
 		scriptIn:           input,
 		scriptOut:          output,
-	}
+	}, nil
+}
+
+// writerStyle convert a Style of the input to an output Style
+func writerStyle(style *reader.Style) *writer.Style {
+	s := NewStyle(style.Name)
+	s.Name = style.Name
+	s.FontName = style.FontName
+	s.FontSize = style.FontSize
+	s.Color = style.Color
+	s.Bold = style.Bold
+	s.Italic = style.Italic
+	s.Underline = style.Underline
+	s.StrikeOut = style.StrikeOut
+	s.Scale = style.Scale
+	s.Spacing = style.Spacing
+	s.Angle = style.Angle
+	s.OpaqueBox = style.OpaqueBox
+	s.Bord = style.Bord
+	s.Shadow = style.Shadow
+	s.Alignment = style.Alignment
+	s.Margin = style.Margin
+	s.Encoding = style.Encoding
+	return s
 }
 
 // NewStyle create a new Style
@@ -0,0 +1,202 @@
+package eyecandy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Alquimista/eyecandy/fontcache"
+)
+
+// testFont the family of utils/testdata/eyecandy-test.ttf: 1000 units
+// per em and a height of 1200 units, so at 60px the em is 50px. A is 600
+// units wide, V 600, g 500, the space 250 and the other chars 500.
+const testFont = "Eyecandy Test"
+
+var addTestFont sync.Once
+
+// testScript create a Script of 1200x900 with a Default style of the test
+// font at 60px and the events (Dialogue lines)
+func testScript(t *testing.T, style, events string) *Script {
+	t.Helper()
+	return NewEffect(testScriptFile(t, style, events))
+}
+
+// testScriptFile write the script of testScript (with the style line
+// if it isn't empty) in a temporary directory
+func testScriptFile(t *testing.T, style, events string) string {
+	t.Helper()
+	addTestFont.Do(func() {
+		src, err := ioutil.ReadFile("utils/testdata/eyecandy-test.ttf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fontcache.Default.AddFont("eyecandy-test.ttf", src); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if style == "" {
+		style = "Style: Default," + testFont +
+			",60,&H00FFFFFF,&H000000FF,&H00000000,&H00000000," +
+			"0,0,0,0,100,100,0,0,1,0,0,7,0,0,0,1"
+	}
+	src := "[Script Info]\nScriptType: v4.00+\nWrapStyle: 2\n" +
+		"PlayResX: 1200\nPlayResY: 900\n\n" +
+		"[V4+ Styles]\n" +
+		"Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, " +
+		"OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, " +
+		"ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, " +
+		"Alignment, MarginL, MarginR, MarginV, Encoding\n" +
+		style + "\n\n" +
+		"[Events]\n" +
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, " +
+		"Effect, Text\n" + events
+	fn := filepath.Join(t.TempDir(), "test.ass")
+	if err := ioutil.WriteFile(fn, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+func TestNewEffectErr(t *testing.T) {
+	fn := testScriptFile(t, "Style: Default,Eyecandy Tset,60,"+
+		"&H00FFFFFF,&H000000FF,&H00000000,&H00000000,"+
+		"0,0,0,0,100,100,0,0,1,0,0,7,0,0,0,1",
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,AV\n")
+	_, err := NewEffectErr(fn)
+	var nf *fontcache.NotFoundError
+	if !errors.As(err, &nf) {
+		t.Fatalf("NewEffectErr error = %v, want a *fontcache.NotFoundError",
+			err)
+	}
+	if nf.Name != "Eyecandy Tset" || len(nf.Similar) == 0 ||
+		nf.Similar[0] != testFont {
+		t.Errorf("NotFoundError = %q %q, want %q [%q]", nf.Name, nf.Similar,
+			"Eyecandy Tset", testFont)
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.ass")
+	if _, err := NewEffectErr(missing); err == nil {
+		t.Error("NewEffectErr of a missing file: no error")
+	}
+	fx, err := NewEffectErr(testScriptFile(t, "",
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,AV\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fx.Lines()); n != 1 {
+		t.Errorf("%d lines, want 1", n)
+	}
+}
+
+func TestLineSeed(t *testing.T) {
+	seed := lineSeed(3, 1, 2000)
+	if lineSeed(3, 1, 2000) != seed {
+		t.Error("lineSeed isn't deterministic")
+	}
+	for _, other := range []int64{
+		lineSeed(4, 1, 2000), lineSeed(3, 0, 2000), lineSeed(3, 2, 2000),
+		lineSeed(3, 1, 1990), lineSeed(3, 1, 2010),
+	} {
+		if other == seed {
+			t.Errorf("lineSeed collision %d", seed)
+		}
+	}
+
+	// the text, end time, style and the other lines don't change the seed
+	a := testScript(t, "",
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,AV\n"+
+			"Dialogue: 0,0:00:02.00,0:00:03.00,Default,,0,0,0,,{\\k50}gA\n")
+	b := testScript(t, "",
+		"Dialogue: 1,0:00:01.00,0:00:09.00,Default,x,0,0,0,,gg Vg\n"+
+			"Dialogue: 0,0:00:02.00,0:00:04.00,Default,,0,0,0,,A\n"+
+			"Dialogue: 0,0:00:05.00,0:00:06.00,Default,,0,0,0,,V\n")
+	la, lb := a.Lines(), b.Lines()
+	for i, line := range la {
+		want := lineSeed(0, i, line.StartTime)
+		if line.Seed() != want || lb[i].Seed() != want {
+			t.Errorf("line %d: Seed() = %d, %d, want %d", i, line.Seed(),
+				lb[i].Seed(), want)
+		}
+		if line.Rand().Int63() != lb[i].Rand().Int63() {
+			t.Errorf("line %d: different random numbers", i)
+		}
+	}
+	if la[0].Seed() == la[1].Seed() {
+		t.Error("the lines have the same seed")
+	}
+}
+
+func TestStream(t *testing.T) {
+	events := "Dialogue: 0,0:00:01.00,0:00:03.00,Default,,0,0,0,," +
+		"{\\k50}AV{\\k30}gA\n" +
+		"Dialogue: 0,0:00:04.00,0:00:05.00,Default,,0,0,0,,{\\k20}A{\\k20}g\n"
+	run := func(fx *Script) {
+		for _, line := range fx.Lines() {
+			for _, syl := range line.Syls() {
+				fx.Add(fx.CopySyl(syl))
+			}
+		}
+	}
+	// the saved and the streamed scripts differ only in the file name
+	tail := func(b []byte) []byte {
+		return b[bytes.Index(b, []byte("[V4+ Styles]")):]
+	}
+
+	fx := testScript(t, "", events)
+	if err := fx.Close(); err != nil {
+		t.Errorf("Close without Stream = %v, want nil", err)
+	}
+	run(fx)
+	fn := filepath.Join(t.TempDir(), "test.fx.ass")
+	if err := fx.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"test.fx.ass", "test.fx.ass.gz"} {
+		fx := testScript(t, "", events)
+		fn := filepath.Join(t.TempDir(), name)
+		if err := fx.Stream(fn); err != nil {
+			t.Fatal(err)
+		}
+		if err := fx.Stream(fn); err == nil {
+			t.Error("Stream twice: no error")
+		}
+		run(fx)
+		if err := fx.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := fx.Close(); err != nil {
+			t.Errorf("Close twice = %v, want nil", err)
+		}
+		f, err := os.Open(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(name, ".gz") {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := ioutil.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(tail(got), tail(want)) {
+			t.Errorf("%s:\n%s\nwant like Save:\n%s", name, got, want)
+		}
+	}
+}
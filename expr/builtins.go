@@ -0,0 +1,503 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Alquimista/eyecandy/asstags"
+	"github.com/Alquimista/eyecandy/color"
+	"github.com/Alquimista/eyecandy/interpolate"
+)
+
+// builtins the variables and functions of Builtins
+var builtins = NewEnv(nil, nil)
+
+// Builtins get a new Env with the builtin functions in its parent:
+//
+//	math: pi, abs, floor, ceil, round(x[, places]), sqrt, exp, log, sin,
+//	cos, tan, asin, acos, atan, atan2, pow, min, max, clamp(x, min, max),
+//	rad, deg
+//	strings: len, upper, lower, rep(s, n), str, num
+//	asstags: bord, xbord, ybord, shad, xshad, yshad, be, blur, fsc, fscx,
+//	fscy, frx, fry, frz, fr, fax, fay, c, alpha, a, an, pos, move, mov,
+//	org, fad, fade, t, clip, iclip
+//	color: gradient(n, colors...[, interp]) the HTML colors of a
+//	gradient, ssa(html) an HTML color as SSA
+//	interpolate: linear(t, start, end), ease, easein... (the interpolate
+//	functions in lower case), bezier(t, points)
+func Builtins() *Env {
+	return NewEnv(nil, builtins)
+}
+
+// define add a builtin function
+func define(name string, fn Func) {
+	builtins.Set(name, fn)
+}
+
+// nums get the arguments as numbers, between min and max of them
+func nums(args []interface{}, min, max int) ([]float64, error) {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return nil, fmt.Errorf("want %d arguments, have %d", min, len(args))
+		}
+		return nil, fmt.Errorf("want %d to %d arguments, have %d",
+			min, max, len(args))
+	}
+	fs := make([]float64, len(args))
+	for i, arg := range args {
+		f, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf("argument %d is a %s, want a number",
+				i+1, typeName(arg))
+		}
+		fs[i] = f
+	}
+	return fs, nil
+}
+
+// str get an argument as a string
+func str(args []interface{}, i int) (string, error) {
+	if i >= len(args) {
+		return "", fmt.Errorf("want %d arguments, have %d", i+1, len(args))
+	}
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("argument %d is a %s, want a string",
+			i+1, typeName(args[i]))
+	}
+	return s, nil
+}
+
+// toInt round a number to an int
+func toInt(f float64) int {
+	return int(math.Round(f))
+}
+
+// math1 a math function of a number
+func math1(f func(float64) float64) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		return f(n[0]), nil
+	}
+}
+
+// tag1 a tag of a number
+func tag1(f func(float64) string) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		return f(n[0]), nil
+	}
+}
+
+// interp a function of the interpolate package
+func interp(f interpolate.Interp) Func {
+	return func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 3, 3)
+		if err != nil {
+			return nil, err
+		}
+		return f(n[0], n[1], n[2]), nil
+	}
+}
+
+// toInterp convert a function of the expressions into an interpolation,
+// an error is a panic (see safeCall)
+func toInterp(fn Func) interpolate.Interp {
+	return func(t, start, end float64) float64 {
+		v, err := fn(t, start, end)
+		if err != nil {
+			panic(err)
+		}
+		f, ok := v.(float64)
+		if !ok {
+			panic(fmt.Sprintf("interpolation result is a %s", typeName(v)))
+		}
+		return f
+	}
+}
+
+func init() {
+	// math
+	builtins.Set("pi", math.Pi)
+	for name, f := range map[string]func(float64) float64{
+		"abs": math.Abs, "floor": math.Floor, "ceil": math.Ceil,
+		"sqrt": math.Sqrt, "exp": math.Exp, "log": math.Log,
+		"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+		"asin": math.Asin, "acos": math.Acos, "atan": math.Atan,
+		"rad": func(d float64) float64 { return d * math.Pi / 180 },
+		"deg": func(r float64) float64 { return r * 180 / math.Pi },
+	} {
+		define(name, math1(f))
+	}
+	define("atan2", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return math.Atan2(n[0], n[1]), nil
+	})
+	define("pow", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return math.Pow(n[0], n[1]), nil
+	})
+	define("round", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		shift := 1.0
+		if len(n) == 2 {
+			shift = math.Pow(10, math.Trunc(n[1]))
+		}
+		return math.Round(n[0]*shift) / shift, nil
+	})
+	define("min", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 1, math.MaxInt32)
+		if err != nil {
+			return nil, err
+		}
+		m := n[0]
+		for _, f := range n[1:] {
+			m = math.Min(m, f)
+		}
+		return m, nil
+	})
+	define("max", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 1, math.MaxInt32)
+		if err != nil {
+			return nil, err
+		}
+		m := n[0]
+		for _, f := range n[1:] {
+			m = math.Max(m, f)
+		}
+		return m, nil
+	})
+	define("clamp", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 3, 3)
+		if err != nil {
+			return nil, err
+		}
+		return math.Max(n[1], math.Min(n[2], n[0])), nil
+	})
+
+	// strings
+	define("len", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("want 1 argument, have %d", len(args))
+		}
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("len of a %s", typeName(args[0]))
+	})
+	define("upper", func(args ...interface{}) (interface{}, error) {
+		s, err := str(args, 0)
+		return strings.ToUpper(s), err
+	})
+	define("lower", func(args ...interface{}) (interface{}, error) {
+		s, err := str(args, 0)
+		return strings.ToLower(s), err
+	})
+	define("rep", func(args ...interface{}) (interface{}, error) {
+		s, err := str(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		n, err := nums(args[1:], 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		if n[0] < 0 {
+			return nil, fmt.Errorf("negative count %s", String(n[0]))
+		}
+		return strings.Repeat(s, toInt(n[0])), nil
+	})
+	define("str", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("want 1 argument, have %d", len(args))
+		}
+		return String(args[0]), nil
+	})
+	define("num", func(args ...interface{}) (interface{}, error) {
+		s, err := str(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return f, nil
+	})
+
+	// asstags
+	for name, f := range map[string]func(float64) string{
+		"bord": asstags.Bord, "xbord": asstags.XBord, "ybord": asstags.YBord,
+		"shad": asstags.Shad, "xshad": asstags.XShad, "yshad": asstags.YShad,
+		"fscx": asstags.Fscx, "fscy": asstags.Fscy,
+		"frx": asstags.Frx, "fry": asstags.Fry, "frz": asstags.Frz,
+		"fr": asstags.Fr, "fax": asstags.Fax, "fay": asstags.Fay,
+		"be": func(f float64) string { return asstags.Be(toInt(f)) },
+		"an": func(f float64) string { return asstags.An(toInt(f)) },
+		// asstags.Blur write \be
+		"blur": func(f float64) string { return fmt.Sprintf(`\blur%g`, f) },
+	} {
+		define(name, tag1(f))
+	}
+	define("fsc", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 1 {
+			return asstags.Fsc(n[0]), nil
+		}
+		return asstags.Fsc(n[0], n[1]), nil
+	})
+	define("pos", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return asstags.Pos(n[0], n[1]), nil
+	})
+	define("org", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return asstags.Org(n[0], n[1]), nil
+	})
+	move := func(f func(args ...interface{}) string) Func {
+		return func(args ...interface{}) (interface{}, error) {
+			n, err := nums(args, 2, 6)
+			if err != nil {
+				return nil, err
+			}
+			if len(n)%2 != 0 {
+				return nil, fmt.Errorf("want 2, 4 or 6 arguments, have %d",
+					len(n))
+			}
+			a := make([]interface{}, len(n))
+			for i, f := range n {
+				a[i] = f
+				if i >= 4 {
+					a[i] = toInt(f)
+				}
+			}
+			return f(a...), nil
+		}
+	}
+	define("move", move(asstags.Move))
+	define("mov", move(asstags.Mov))
+	define("fad", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return asstags.Fad(toInt(n[0]), toInt(n[1])), nil
+	})
+	define("fade", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 2, 7)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) != 2 && len(n) != 7 {
+			return nil, fmt.Errorf("want 2 or 7 arguments, have %d", len(n))
+		}
+		a := make([]interface{}, len(n))
+		for i, f := range n {
+			a[i] = toInt(f)
+		}
+		return asstags.Fade(a...), nil
+	})
+	define("c", func(args ...interface{}) (interface{}, error) {
+		if len(args) == 1 {
+			s, err := str(args, 0)
+			return asstags.C(s), err
+		}
+		n, err := nums(args[:1], 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := str(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return asstags.C(toInt(n[0]), s), nil
+	})
+	define("alpha", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		return asstags.A(toInt(n[0])), nil
+	})
+	define("a", func(args ...interface{}) (interface{}, error) {
+		n, err := nums(args, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		// asstags.A write \1&H.. without the "a"
+		return fmt.Sprintf(`\%da&H%02X`, toInt(n[0]), toInt(n[1])), nil
+	})
+	define("t", func(args ...interface{}) (interface{}, error) {
+		if len(args) < 1 || len(args) > 4 {
+			return nil, fmt.Errorf("want 1 to 4 arguments, have %d", len(args))
+		}
+		last := len(args) - 1
+		m, err := str(args, last)
+		if err != nil {
+			return nil, err
+		}
+		n, err := nums(args[:last], 0, 3)
+		if err != nil {
+			return nil, err
+		}
+		switch len(n) {
+		case 0:
+			return asstags.T(m), nil
+		case 1:
+			return asstags.T(n[0], m), nil
+		case 2:
+			return asstags.T(toInt(n[0]), toInt(n[1]), m), nil
+		}
+		// asstags.T(t1, t2, accel, modifiers) read the accel from t1
+		return fmt.Sprintf(`\t(%d,%d,%0.2f,%s)`,
+			toInt(n[0]), toInt(n[1]), n[2], m), nil
+	})
+	clip := func(f func(x1, y1, x2, y2 int) string) Func {
+		return func(args ...interface{}) (interface{}, error) {
+			n, err := nums(args, 4, 4)
+			if err != nil {
+				return nil, err
+			}
+			return f(toInt(n[0]), toInt(n[1]), toInt(n[2]), toInt(n[3])), nil
+		}
+	}
+	define("clip", clip(asstags.Clip))
+	// asstags.IClip write \clip
+	define("iclip", clip(func(x1, y1, x2, y2 int) string {
+		return fmt.Sprintf(`\iclip(%d,%d,%d,%d)`, x1, y1, x2, y2)
+	}))
+
+	// color
+	define("gradient", func(args ...interface{}) (interface{}, error) {
+		if len(args) < 3 {
+			return nil, fmt.Errorf("want at least 3 arguments, have %d",
+				len(args))
+		}
+		n, err := nums(args[:1], 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		f := interpolate.Linear
+		colors := args[1:]
+		if fn, ok := colors[len(colors)-1].(Func); ok {
+			f = toInterp(fn)
+			colors = colors[:len(colors)-1]
+		}
+		if len(colors) == 1 {
+			if list, ok := colors[0].([]interface{}); ok {
+				colors = list
+			}
+		}
+		if len(colors) < 2 {
+			return nil, fmt.Errorf("want at least 2 colors, have %d",
+				len(colors))
+		}
+		clrs := make([]*color.Color, len(colors))
+		for i := range colors {
+			s, err := str(colors, i)
+			if err != nil {
+				return nil, err
+			}
+			clrs[i] = color.NewFromHTML(s)
+		}
+		var out []interface{}
+		for _, c := range color.Gradient(toInt(n[0]), clrs, f) {
+			out = append(out, c.HTML())
+		}
+		return out, nil
+	})
+	define("ssa", func(args ...interface{}) (interface{}, error) {
+		s, err := str(args, 0)
+		return color.NewFromHTML(s).SSA(), err
+	})
+
+	// interpolate
+	for name, f := range map[string]interpolate.Interp{
+		"linear": interpolate.Linear, "linearsqr": interpolate.LinearSqr,
+		"cosine": interpolate.Cosine, "sine": interpolate.Sine,
+		"smoothstep":         interpolate.SmoothStep,
+		"smoothstepdouble":   interpolate.SmoothStepDouble,
+		"acceleration":       interpolate.Acceleration,
+		"cubicacceleration":  interpolate.CubicAcceleration,
+		"deccelaration":      interpolate.Deccelaration,
+		"cubicdeccelaration": interpolate.CubicDeccelaration,
+		"sigmoid":            interpolate.Sigmoid,
+		"ease":               interpolate.Ease,
+		"easein":             interpolate.EaseIn,
+		"easeout":            interpolate.EaseOut,
+		"easeinout":          interpolate.EaseInOut,
+		"easeinquad":         interpolate.EaseInQuad,
+		"easeincubic":        interpolate.EaseInCubic,
+		"easeinquart":        interpolate.EaseInQuart,
+		"easeinquint":        interpolate.EaseInQuint,
+		"easeinsine":         interpolate.EaseInSine,
+		"easeinexpo":         interpolate.EaseInExpo,
+		"easeincirc":         interpolate.EaseInCirc,
+		"easeoutquad":        interpolate.EaseOutQuad,
+		"easeoutcubic":       interpolate.EaseOutCubic,
+		"easeoutquart":       interpolate.EaseOutQuart,
+		"easeoutquint":       interpolate.EaseOutQuint,
+		"easeoutsine":        interpolate.EaseOutSine,
+		"easeoutexpo":        interpolate.EaseOutExpo,
+		"easeoutcirc":        interpolate.EaseOutCirc,
+		"easeinoutquad":      interpolate.EaseInOutQuad,
+		"easeinoutcubic":     interpolate.EaseInOutCubic,
+		"easeinoutquart":     interpolate.EaseInOutQuart,
+		"easeinoutquint":     interpolate.EaseInOutQuint,
+		"easeinoutsine":      interpolate.EaseInOutSine,
+		"easeinoutexpo":      interpolate.EaseInOutExpo,
+		"easeinoutcirc":      interpolate.EaseInOutCirc,
+		"backstart":          interpolate.Backstart,
+		"boing":              interpolate.Boing,
+	} {
+		define(name, interp(f))
+	}
+	define("bezier", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("want 2 arguments, have %d", len(args))
+		}
+		t, err := nums(args[:1], 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		list, ok := args[1].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("argument 2 is a %s, want a list",
+				typeName(args[1]))
+		}
+		points, err := nums(list, 1, len(list))
+		if err != nil {
+			return nil, err
+		}
+		return interpolate.BezierCurve(t[0], points), nil
+	})
+}
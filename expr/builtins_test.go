@@ -0,0 +1,33 @@
+package expr
+
+import "testing"
+
+func TestBuiltinTags(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"bord(2)", `\bord2`},
+		{"blur(1.5)", `\blur1.5`},
+		{"be(2)", `\be2`},
+		{"an(7)", `\an7`},
+		{"pos(10, 20.5)", `\pos(10,20.5)`},
+		{"alpha(255)", `\alpha&HFF`},
+		{"a(3, 128)", `\3a&H80`},
+		{`t("\frz360")`, `\t(\frz360)`},
+		{`t(0, 500, "\frz360")`, `\t(0,500,\frz360)`},
+		{`t(0, 500, 0.5, "\frz360")`, `\t(0,500,0.50,\frz360)`},
+		{"clip(0, 0, 100, 50)", `\clip(0,0,100,50)`},
+		{"iclip(0, 0, 100, 50)", `\iclip(0,0,100,50)`},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.src, Builtins())
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Alquimista/eyecandy/utils"
+)
+
+// Func a function callable by the expressions, the values are float64,
+// string, bool, nil, []interface{} (lists), map[string]interface{}
+// (objects) and Func
+type Func func(args ...interface{}) (interface{}, error)
+
+// Env the variables of an expression, the ones not found are looked up
+// in the parent Env. The assignments of the code set the variables of
+// the Env where they are run.
+type Env struct {
+	vars   map[string]interface{}
+	parent *Env
+}
+
+// NewEnv create an Env with the variables vars (nil for new ones)
+// and a parent Env (nil for none)
+func NewEnv(vars map[string]interface{}, parent *Env) *Env {
+	if vars == nil {
+		vars = make(map[string]interface{})
+	}
+	return &Env{vars: vars, parent: parent}
+}
+
+// Get get a variable
+func (e *Env) Get(name string) (interface{}, bool) {
+	for ; e != nil; e = e.parent {
+		if v, ok := e.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Set set a variable of the Env
+func (e *Env) Set(name string, v interface{}) {
+	e.vars[name] = v
+}
+
+// node a node of a parsed expression
+type node interface {
+	eval(x *evaluator) (interface{}, error)
+}
+
+type literal struct {
+	v interface{}
+}
+
+type name struct {
+	pos  int
+	name string
+}
+
+type list struct {
+	items []node
+}
+
+type unary struct {
+	pos int
+	op  string
+	x   node
+}
+
+type binary struct {
+	pos  int
+	op   string
+	x, y node
+}
+
+type ternary struct {
+	pos        int
+	cond, a, b node
+}
+
+type call struct {
+	pos  int
+	fn   node
+	args []node
+}
+
+type field struct {
+	pos  int
+	x    node
+	name string
+}
+
+type index struct {
+	pos  int
+	x, i node
+}
+
+// evaluator the state of an evaluation
+type evaluator struct {
+	src string
+	env *Env
+}
+
+func (x *evaluator) errorf(pos int, format string, args ...interface{}) error {
+	return &Error{x.src, pos, fmt.Sprintf(format, args...)}
+}
+
+// Eval evaluate the expression
+func (e *Expr) Eval(env *Env) (interface{}, error) {
+	return e.root.eval(&evaluator{e.src, env})
+}
+
+// Run run the statements of the code, the assignments set the
+// variables of env
+func (c *Code) Run(env *Env) error {
+	x := &evaluator{c.src, env}
+	for _, s := range c.stmts {
+		v, err := s.x.eval(x)
+		if err != nil {
+			return err
+		}
+		if s.name != "" {
+			env.Set(s.name, v)
+		}
+	}
+	return nil
+}
+
+// Eval parse and evaluate an expression
+func Eval(src string, env *Env) (interface{}, error) {
+	e, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return e.Eval(env)
+}
+
+// String format a value for the text of a template,
+// the numbers rounded to 3 decimals and nil is empty
+func String(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(utils.Round(v, 3), 'f', -1, 64)
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = String(item)
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	case Func:
+		return "function"
+	}
+	return fmt.Sprint(v)
+}
+
+// typeName the name of the type of a value for the errors
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	case Func:
+		return "function"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// truth get if a value is true, like Lua only nil and false are false
+func truth(v interface{}) bool {
+	b, ok := v.(bool)
+	return v != nil && (!ok || b)
+}
+
+func (n *literal) eval(x *evaluator) (interface{}, error) {
+	return n.v, nil
+}
+
+func (n *name) eval(x *evaluator) (interface{}, error) {
+	v, ok := x.env.Get(n.name)
+	if !ok {
+		return nil, x.errorf(n.pos, "undefined %q", n.name)
+	}
+	return v, nil
+}
+
+func (n *list) eval(x *evaluator) (interface{}, error) {
+	items := make([]interface{}, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(x)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, nil
+}
+
+func (n *unary) eval(x *evaluator) (interface{}, error) {
+	v, err := n.x.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	if n.op != "-" {
+		return !truth(v), nil
+	}
+	f, ok := v.(float64)
+	if !ok {
+		return nil, x.errorf(n.pos, "invalid operand %s of -", typeName(v))
+	}
+	return -f, nil
+}
+
+func (n *ternary) eval(x *evaluator) (interface{}, error) {
+	cond, err := n.cond.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	if truth(cond) {
+		return n.a.eval(x)
+	}
+	return n.b.eval(x)
+}
+
+func (n *binary) eval(x *evaluator) (interface{}, error) {
+	a, err := n.x.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	// short circuit
+	switch n.op {
+	case "and", "&&":
+		if !truth(a) {
+			return a, nil
+		}
+		return n.y.eval(x)
+	case "or", "||":
+		if truth(a) {
+			return a, nil
+		}
+		return n.y.eval(x)
+	}
+	b, err := n.y.eval(x)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "..":
+		return String(a) + String(b), nil
+	case "==":
+		return equal(a, b), nil
+	case "~=":
+		return !equal(a, b), nil
+	}
+
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok {
+			switch n.op {
+			case "+":
+				return sa + sb, nil
+			case "<":
+				return sa < sb, nil
+			case "<=":
+				return sa <= sb, nil
+			case ">":
+				return sa > sb, nil
+			case ">=":
+				return sa >= sb, nil
+			}
+		}
+	}
+	fa, oka := a.(float64)
+	fb, okb := b.(float64)
+	if !oka || !okb {
+		return nil, x.errorf(n.pos, "invalid operands %s %s %s",
+			typeName(a), n.op, typeName(b))
+	}
+	switch n.op {
+	case "+":
+		return fa + fb, nil
+	case "-":
+		return fa - fb, nil
+	case "*":
+		return fa * fb, nil
+	case "/":
+		if fb == 0 {
+			return nil, x.errorf(n.pos, "division by zero")
+		}
+		return fa / fb, nil
+	case "%":
+		if fb == 0 {
+			return nil, x.errorf(n.pos, "division by zero")
+		}
+		// like Lua the result has the sign of the divisor
+		return fa - math.Floor(fa/fb)*fb, nil
+	case "^":
+		return math.Pow(fa, fb), nil
+	case "<":
+		return fa < fb, nil
+	case "<=":
+		return fa <= fb, nil
+	case ">":
+		return fa > fb, nil
+	case ">=":
+		return fa >= fb, nil
+	}
+	return nil, x.errorf(n.pos, "invalid operator %q", n.op)
+}
+
+// equal compare two values, the lists, objects and functions
+// are never equal
+func equal(a, b interface{}) bool {
+	switch a.(type) {
+	case nil, float64, string, bool:
+		return a == b
+	}
+	return false
+}
+
+func (n *call) eval(x *evaluator) (interface{}, error) {
+	v, err := n.fn.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := v.(Func)
+	if !ok {
+		return nil, x.errorf(n.pos, "call of a %s", typeName(v))
+	}
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		if args[i], err = arg.eval(x); err != nil {
+			return nil, err
+		}
+	}
+	r, err := safeCall(fn, args)
+	if err != nil {
+		if _, ok := err.(*Error); ok {
+			return nil, err
+		}
+		return nil, x.errorf(n.pos, "%s", err)
+	}
+	return r, nil
+}
+
+// safeCall call a function, a panic is returned as an error
+func safeCall(fn Func, args []interface{}) (r interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			r, err = nil, fmt.Errorf("%v", p)
+		}
+	}()
+	return fn(args...)
+}
+
+func (n *field) eval(x *evaluator) (interface{}, error) {
+	v, err := n.x.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, x.errorf(n.pos, "field %q of a %s", n.name, typeName(v))
+	}
+	f, ok := obj[n.name]
+	if !ok {
+		return nil, x.errorf(n.pos, "undefined field %q", n.name)
+	}
+	return f, nil
+}
+
+func (n *index) eval(x *evaluator) (interface{}, error) {
+	v, err := n.x.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.i.eval(x)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		f, ok := i.(float64)
+		if !ok {
+			return nil, x.errorf(n.pos, "index of a list with a %s",
+				typeName(i))
+		}
+		if f != math.Trunc(f) || f < 0 || int(f) >= len(v) {
+			return nil, x.errorf(n.pos, "index %s out of range [0, %d)",
+				String(f), len(v))
+		}
+		return v[int(f)], nil
+	case map[string]interface{}:
+		s, ok := i.(string)
+		if !ok {
+			return nil, x.errorf(n.pos, "index of an object with a %s",
+				typeName(i))
+		}
+		return v[s], nil
+	}
+	return nil, x.errorf(n.pos, "index of a %s", typeName(v))
+}
@@ -0,0 +1,150 @@
+package expr
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testEnv() *Env {
+	return NewEnv(map[string]interface{}{
+		"x":    2.0,
+		"s":    "syl",
+		"list": []interface{}{1.0, "two"},
+		"obj":  map[string]interface{}{"n": 3.0},
+		"fail": Func(func(args ...interface{}) (interface{}, error) {
+			return nil, errors.New("failed")
+		}),
+		"boom": Func(func(args ...interface{}) (interface{}, error) {
+			panic("boom")
+		}),
+	}, Builtins())
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{"1 + 2 * 3", 7.0},
+		{"(1 + 2) * 3", 9.0},
+		{"2 ^ 3 ^ 2", 512.0},
+		{"-2 ^ 2", -4.0},
+		{"7 % 3", 1.0},
+		{"x / 4", 0.5},
+		{"1e3", 1000.0},
+		{".5", 0.5},
+		{`s .. "-" .. x`, "syl-2"},
+		{"1 .. 2", "12"},
+		{"x == 2", true},
+		{"x ~= 2", false},
+		{`s == "syl"`, true},
+		{"x >= 2 and x < 3", true},
+		{"nil or 5", 5.0},
+		{"false and boom()", false},
+		{"not nil", true},
+		{"not 0", false}, // like Lua 0 is true
+		{"x > 1 ? \"big\" : \"small\"", "big"},
+		{"list[1]", "two"},
+		{"obj.n", 3.0},
+		{`"a \"b\" \\c"`, `a "b" \c`},
+		{`"\blur"`, `\blur`},
+		{"max(1, x, 3)", 3.0},
+		{"[1, x][1]", 2.0},
+		{"nil", nil},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.src, testEnv())
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Eval(%q) = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{"y + 1", 1, `undefined "y"`},
+		{`-"a"`, 1, "invalid operand string of -"},
+		{`1 + "a"`, 3, "invalid operands number + string"},
+		{"x / 0", 3, "division by zero"},
+		{"x % 0", 3, "division by zero"},
+		{"x < true", 3, "invalid operands number < boolean"},
+		{"x(1)", 2, "call of a number"},
+		{"fail()", 5, "failed"},
+		{"boom(1)", 5, "boom"},
+		{"sin()", 4, "want 1 arguments, have 0"},
+		{`bord("a")`, 5, "argument 1 is a string, want a number"},
+		{"x.n", 3, `field "n" of a number`},
+		{"obj.m", 5, `undefined field "m"`},
+		{"list[2]", 5, "index 2 out of range [0, 2)"},
+		{`list["a"]`, 5, "index of a list with a string"},
+		{"obj[1]", 4, "index of an object with a number"},
+		{"x[0]", 2, "index of a number"},
+		// the error of the inner expression
+		{"1 + (2 * y)", 10, `undefined "y"`},
+	}
+	for _, tt := range tests {
+		_, err := Eval(tt.src, testEnv())
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("Eval(%q) error = %v, want an *Error", tt.src, err)
+			continue
+		}
+		if e.Pos != tt.pos || e.Msg != tt.msg {
+			t.Errorf("Eval(%q) error = %q at %d, want %q at %d",
+				tt.src, e.Msg, e.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	env := testEnv()
+	c, err := ParseCode("a = x * 2; b = a .. s; x = 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(env); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]interface{}{
+		"a": 4.0, "b": "4syl", "x": 10.0} {
+		if got, _ := env.Get(name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", name, got, want)
+		}
+	}
+	c, err = ParseCode("a = 1; b = y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(env); err == nil {
+		t.Error("Run of an undefined variable didn't fail")
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, ""},
+		{1.0, "1"},
+		{1.23456, "1.235"},
+		{-0.5, "-0.5"},
+		{true, "true"},
+		{"text", "text"},
+		{[]interface{}{1.0, "a"}, "[1,a]"},
+	}
+	for _, tt := range tests {
+		if got := String(tt.v); got != tt.want {
+			t.Errorf("String(%#v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+// Package expr evaluate the small expression language of the karaoke
+// templates: numbers, strings and booleans, arithmetic (+ - * / % ^),
+// comparisons (== ~= < <= > >=), logic (and or not), the ternary
+// cond ? a : b, string concatenation (..), lists, fields and function
+// calls. Like Lua there is no "!" operator, it delimit the expressions
+// of the templates (!expr!). It's sandboxed: only the variables and
+// functions of the Env are reachable, see Builtins for the math, asstags,
+// color and interpolate functions.
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Error a parse or runtime error of an expression,
+// Pos is the offset of the error in the source (from 1)
+type Error struct {
+	Src string
+	Pos int
+	Msg string
+}
+
+// Error get the Error as a String
+func (e *Error) Error() string {
+	return fmt.Sprintf("expr: %s at column %d of %q", e.Msg, e.Pos, e.Src)
+}
+
+// token kinds
+const (
+	tokEOF = iota
+	tokNum
+	tokStr
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind int
+	text string
+	num  float64
+	pos  int
+}
+
+// operators, the longest first
+var operators = []string{
+	"..", "==", "~=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "^", "<", ">", "?", ":",
+	"(", ")", "[", "]", ",", ".", "=", ";",
+}
+
+// lex split the source in tokens
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' ||
+			c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' ||
+				src[j] == '.' && !strings.HasPrefix(src[j:], "..")) {
+				j++
+			}
+			if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+				k := j + 1
+				if k < len(src) && (src[k] == '+' || src[k] == '-') {
+					k++
+				}
+				if k < len(src) && src[k] >= '0' && src[k] <= '9' {
+					for j = k; j < len(src) && src[j] >= '0' && src[j] <= '9'; j++ {
+					}
+				}
+			}
+			f, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, &Error{src, i + 1, fmt.Sprintf("invalid number %q",
+					src[i:j])}
+			}
+			toks = append(toks, token{tokNum, src[i:j], f, i + 1})
+			i = j
+		case c == '"' || c == '\'':
+			// only the quote and the backslash are escaped,
+			// "\blur" is the text of a tag
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(src) && rune(src[j]) != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) &&
+					(rune(src[j+1]) == c || src[j+1] == '\\') {
+					j++
+				}
+				b.WriteByte(src[j])
+			}
+			if j == len(src) {
+				return nil, &Error{src, i + 1, "unterminated string"}
+			}
+			toks = append(toks, token{tokStr, b.String(), 0, i + 1})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(src) && (src[j] == '_' ||
+				unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, src[i:j], 0, i + 1})
+			i = j
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &Error{src, i + 1, fmt.Sprintf("unexpected %q", c)}
+			}
+			toks = append(toks, token{tokOp, op, 0, i + 1})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "", 0, len(src) + 1}), nil
+}
+
+// parser a recursive descent parser of the tokens
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// is get if the next token is one of the operators or keywords
+func (p *parser) is(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &Error{p.src, t.pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expect(op string) error {
+	t := p.next()
+	if t.kind != tokOp || t.text != op {
+		return p.errorf(t, "expected %q, found %s", op, describe(t))
+	}
+	return nil
+}
+
+// describe a token for the errors
+func describe(t token) string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+// expr := or ['?' expr ':' expr]
+func (p *parser) expr() (node, error) {
+	cond, err := p.binary(0)
+	if err != nil || !p.is("?") {
+		return cond, err
+	}
+	t := p.next()
+	a, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	b, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &ternary{t.pos, cond, a, b}, nil
+}
+
+// levels the binary operators by precedence, the lowest first
+var levels = [][]string{
+	{"or", "||"},
+	{"and", "&&"},
+	{"==", "~=", "<", "<=", ">", ">="},
+	{".."},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// binary parse the binary operators of a precedence level,
+// the concatenation is right associative
+func (p *parser) binary(level int) (node, error) {
+	if level == len(levels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.is(levels[level]...) {
+		t := p.next()
+		var right node
+		if t.text == ".." {
+			right, err = p.binary(level)
+		} else {
+			right, err = p.binary(level + 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{t.pos, t.text, left, right}
+		if t.text == ".." {
+			break
+		}
+	}
+	return left, nil
+}
+
+// unary := ('-' | 'not') unary | power
+func (p *parser) unary() (node, error) {
+	if p.is("-", "not") {
+		t := p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{t.pos, t.text, x}, nil
+	}
+	return p.power()
+}
+
+// power := postfix ['^' unary], right associative
+func (p *parser) power() (node, error) {
+	x, err := p.postfix()
+	if err != nil || !p.is("^") {
+		return x, err
+	}
+	t := p.next()
+	y, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return &binary{t.pos, "^", x, y}, nil
+}
+
+// postfix := primary { '(' args ')' | '.' name | '[' expr ']' }
+func (p *parser) postfix() (node, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.is("("):
+			t := p.next()
+			args, err := p.list(")")
+			if err != nil {
+				return nil, err
+			}
+			x = &call{t.pos, x, args}
+		case p.is("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent {
+				return nil, p.errorf(t, "expected field name, found %s",
+					describe(t))
+			}
+			x = &field{t.pos, x, t.text}
+		case p.is("["):
+			t := p.next()
+			i, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &index{t.pos, x, i}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// list parse expressions separated by commas until the end operator
+func (p *parser) list(end string) (nodes []node, err error) {
+	if p.is(end) {
+		p.next()
+		return nil, nil
+	}
+	for {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, x)
+		if p.is(",") {
+			p.next()
+			continue
+		}
+		return nodes, p.expect(end)
+	}
+}
+
+// primary := number | string | true | false | nil | name
+// | '(' expr ')' | '[' list ']'
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		return &literal{t.num}, nil
+	case tokStr:
+		return &literal{t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &literal{t.text == "true"}, nil
+		case "nil":
+			return &literal{nil}, nil
+		case "and", "or", "not":
+			return nil, p.errorf(t, "unexpected %s", describe(t))
+		}
+		return &name{t.pos, t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			items, err := p.list("]")
+			if err != nil {
+				return nil, err
+			}
+			return &list{items}, nil
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", describe(t))
+}
+
+// Expr a parsed expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse parse an expression
+func Parse(src string) (*Expr, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, toks: toks}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", describe(t))
+	}
+	return &Expr{src, root}, nil
+}
+
+// Code parsed statements: assignments (name = expr) and expressions,
+// separated by semicolons
+type Code struct {
+	src   string
+	stmts []stmt
+}
+
+// stmt an assignment, or an expression without name
+type stmt struct {
+	name string
+	x    node
+}
+
+// ParseCode parse the statements of a code line
+func ParseCode(src string) (*Code, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, toks: toks}
+	c := &Code{src: src}
+	for p.peek().kind != tokEOF {
+		if p.is(";") {
+			p.next()
+			continue
+		}
+		var s stmt
+		if t := p.peek(); t.kind == tokIdent && p.toks[p.i+1].text == "=" &&
+			p.toks[p.i+1].kind == tokOp {
+			s.name = t.text
+			p.i += 2
+		}
+		if s.x, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t.kind != tokEOF && !p.is(";") {
+			return nil, p.errorf(t, "expected \";\", found %s", describe(t))
+		}
+		c.stmts = append(c.stmts, s)
+	}
+	return c, nil
+}
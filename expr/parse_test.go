@@ -0,0 +1,76 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{"", 1, "unexpected end of expression"},
+		{"1 +", 4, "unexpected end of expression"},
+		{"1 2", 3, `unexpected "2"`},
+		{"(1 + 2", 7, `expected ")", found end of expression`},
+		{"f(1, 2", 7, `expected ")", found end of expression`},
+		{"[1, 2", 6, `expected "]", found end of expression`},
+		{"a[1", 4, `expected "]", found end of expression`},
+		{"a.+", 3, `expected field name, found "+"`},
+		{"a.1", 2, `unexpected ".1"`},
+		{"x ? 1", 6, `expected ":", found end of expression`},
+		{`"abc`, 1, "unterminated string"},
+		{"1 # 2", 3, `unexpected '#'`},
+		// like Lua there is no "!", it delimit the template expressions
+		{"!x", 1, `unexpected '!'`},
+		{"a != b", 3, `unexpected '!'`},
+		{"1 + and", 5, `unexpected "and"`},
+		{"1.2.3", 1, `invalid number "1.2.3"`},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.src)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("Parse(%q) error = %v, want an *Error", tt.src, err)
+			continue
+		}
+		if e.Pos != tt.pos || e.Msg != tt.msg || e.Src != tt.src {
+			t.Errorf("Parse(%q) error = %q at %d, want %q at %d",
+				tt.src, e.Msg, e.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestParseCodeError(t *testing.T) {
+	tests := []struct {
+		src string
+		pos int
+		msg string
+	}{
+		{"a = 1 b = 2", 7, `expected ";", found "b"`},
+		{"a = ", 5, "unexpected end of expression"},
+		{"a = 1; = 2", 8, `unexpected "="`},
+	}
+	for _, tt := range tests {
+		_, err := ParseCode(tt.src)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("ParseCode(%q) error = %v, want an *Error", tt.src, err)
+			continue
+		}
+		if e.Pos != tt.pos || e.Msg != tt.msg {
+			t.Errorf("ParseCode(%q) error = %q at %d, want %q at %d",
+				tt.src, e.Msg, e.Pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	_, err := Parse("1 +")
+	want := `expr: unexpected end of expression at column 4 of "1 +"`
+	if err == nil || err.Error() != want {
+		t.Errorf("Parse error = %v, want %q", err, want)
+	}
+}
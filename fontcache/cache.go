@@ -1,23 +1,103 @@
+// Package fontcache find and load the fonts installed in the system
 package fontcache
 
 import (
+	"fmt"
 	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 
-	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
 )
 
-type Cache map[string]*truetype.Font
+// EnvFontPath environment variable with the font directories to use
+// instead of the system ones (separated by os.PathListSeparator)
+const EnvFontPath = "EYECANDY_FONT_PATH"
+
+// maxSimilar number of close family names listed in a NotFoundError
+const maxSimilar = 5
+
+// Key identify a font face in the Cache
+type Key struct {
+	Family string // lowercase family name
+	Weight int    // 100 (Thin) to 900 (Black)
+	Italic bool
+}
+
+// Font a parsed font face and the file where it was found
+type Font struct {
+	*sfnt.Font
+	Family string
+	Weight int
+	Italic bool
+	Path   string
+	Index  int // index of the face in a font collection (.ttc)
+	// height over and under the baseline in font units,
+	// the font size is the sum of both
+	Ascent  int
+	Descent int
+}
+
+// Cache the font faces found, by family, weight and italic
+type Cache map[Key]*Font
 
 func New() Cache {
 	return make(Cache)
 }
 
-var FontPaths = []string{
-	filepath.Join(os.Getenv("windir"), "Fonts"),
-	filepath.Join(os.Getenv("localappdata"), "Microsoft", "Windows", "Fonts"),
+// FontPaths the directories where the fonts are searched
+var FontPaths = SystemFontPaths()
+
+// SystemFontPaths list the font directories of the system,
+// or the directories of EYECANDY_FONT_PATH if it's set.
+func SystemFontPaths() []string {
+	if env := os.Getenv(EnvFontPath); env != "" {
+		return filepath.SplitList(env)
+	}
+
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "windows":
+		return []string{
+			filepath.Join(os.Getenv("windir"), "Fonts"),
+			filepath.Join(os.Getenv("localappdata"),
+				"Microsoft", "Windows", "Fonts"),
+		}
+	case "darwin":
+		return []string{
+			filepath.Join(home, "Library", "Fonts"),
+			"/Library/Fonts",
+			"/System/Library/Fonts",
+			"/Network/Library/Fonts",
+		}
+	}
+
+	// XDG Base Directory, the same directories used by fontconfig
+	var paths []string
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" && home != "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	if dataHome != "" {
+		paths = append(paths, filepath.Join(dataHome, "fonts"))
+	}
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".fonts"))
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	for _, dir := range filepath.SplitList(dataDirs) {
+		paths = append(paths, filepath.Join(dir, "fonts"))
+	}
+	return append(paths, "/usr/X11R6/lib/X11/fonts")
 }
 
 // Init returns a list of all font files found on the system.
@@ -27,26 +107,255 @@ func (c Cache) Init(paths []string) {
 	}
 }
 
+// isFontFile get if the file extension is a supported font format
+func isFontFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ttf", ".otf", ".ttc", ".otc":
+		return true
+	}
+	return false
+}
+
 func (c Cache) loadFont(path string, info os.FileInfo, err error) error {
-	// process ttf files only
-	if info.IsDir() == false && strings.HasSuffix(strings.ToLower(path), ".ttf") {
-		// if strings.ToLower(path[len(path)-4:]) != ".ttf" {
-		// 	return nil
-		// }
-		ttfBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		// missing or unreadable directory
+		return nil
+	}
+	if info.IsDir() || !isFontFile(path) {
+		return nil
+	}
+	fontBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Printf("fontcache: skipping %s: %s", path, err)
+		return nil
+	}
+	if err := c.Add(path, fontBytes); err != nil {
+		log.Printf("fontcache: skipping %s: %s", path, err)
+	}
+	return nil
+}
+
+// Add parse a font file (TrueType, OpenType or a collection)
+// and add its faces to the Cache
+func (c Cache) Add(path string, src []byte) error {
+	fonts, err := ParseFonts(path, src)
+	if err != nil {
+		return err
+	}
+	for _, f := range fonts {
+		c.add(f)
+	}
+	return nil
+}
+
+// add a Font to the Cache, keeping the first one found for each Key
+func (c Cache) add(f *Font) {
+	for _, family := range familyNames(f.Font) {
+		key := Key{strings.ToLower(family), f.Weight, f.Italic}
+		if _, ok := c[key]; !ok {
+			c[key] = f
+		}
+	}
+}
+
+// ParseFonts parse the faces of a font file
+func ParseFonts(path string, src []byte) (fonts []*Font, err error) {
+	coll, err := sfnt.ParseCollection(src)
+	if err != nil {
+		return nil, err
+	}
+	offsets := faceOffsets(src)
+	for i := 0; i < coll.NumFonts(); i++ {
+		sf, err := coll.Font(i)
 		if err != nil {
-			//log.Fatal(err)
-			return err
+			return nil, err
 		}
-		fontFace, err := truetype.Parse(ttfBytes)
+		family, err := sf.Name(nil, sfnt.NameIDFamily)
 		if err != nil {
-			//log.Fatal(err)
-			return err
+			return nil, err
+		}
+		f := &Font{Font: sf, Family: family, Path: path, Index: i,
+			Weight: WeightRegular}
+		var os2 []byte
+		if i < len(offsets) {
+			os2 = os2Table(src, offsets[i])
+		}
+		f.Weight, f.Italic = os2Style(os2)
+		if f.Weight == 0 {
+			f.Weight, f.Italic = nameStyle(sf)
 		}
-		name := strings.ToLower(fontFace.Name(truetype.NameIDFontFamily))
-		c[name] = fontFace
+		f.Ascent, f.Descent = os2Height(os2)
+		if f.Ascent+f.Descent <= 0 {
+			// without OS/2 use the hhea metrics
+			upem := fixed.I(int(sf.UnitsPerEm()))
+			m, err := sf.Metrics(nil, upem, font.HintingNone)
+			if err != nil {
+				return nil, err
+			}
+			f.Ascent, f.Descent = m.Ascent.Round(), m.Descent.Round()
+		}
+		fonts = append(fonts, f)
 	}
-	return nil
+	return fonts, nil
+}
+
+// familyNames the names of the family of a font, GDI (ID 1) and
+// typographic (ID 16), e.g. "Arial Black" and "Arial"
+func familyNames(f *sfnt.Font) (names []string) {
+	for _, id := range []sfnt.NameID{
+		sfnt.NameIDFamily, sfnt.NameIDTypographicFamily} {
+		name, err := f.Name(nil, id)
+		if err == nil && name != "" {
+			names = appendUnique(names, name)
+		}
+	}
+	return names
+}
+
+func appendUnique(slice []string, s string) []string {
+	for _, ele := range slice {
+		if strings.EqualFold(ele, s) {
+			return slice
+		}
+	}
+	return append(slice, s)
+}
+
+// NotFoundError is returned when a font family isn't in the Cache
+type NotFoundError struct {
+	Name    string
+	Similar []string // close family names
+}
+
+func (e *NotFoundError) Error() string {
+	msg := fmt.Sprintf("fontcache: font not found %q", e.Name)
+	if len(e.Similar) > 0 {
+		msg += ", did you mean " + strings.Join(e.Similar, ", ") + "?"
+	}
+	return msg
+}
+
+// Find get the face of a font family (case insensitive) closest to
+// the weight and italic wanted, like the renderers the italic is matched
+// first and then the closest weight.
+// Return a *NotFoundError if the family isn't in the Cache.
+func (c Cache) Find(name string, weight int, italic bool) (*Font, error) {
+	keys := make([]Key, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	key, ok := bestKey(keys, name, weight, italic)
+	if !ok {
+		return nil, &NotFoundError{Name: name, Similar: c.Similar(name)}
+	}
+	return c[key], nil
+}
+
+// bestKey select the Key of the family closest to the weight and italic
+func bestKey(keys []Key, name string, weight int, italic bool) (Key, bool) {
+	family := strings.ToLower(name)
+	var best Key
+	found := false
+	bestScore := 0
+	for _, key := range keys {
+		if key.Family != family {
+			continue
+		}
+		score := absInt(key.Weight - weight)
+		if key.Italic != italic {
+			score += 1000
+		}
+		if !found || score < bestScore ||
+			(score == bestScore && key.Weight < best.Weight) {
+			best, bestScore, found = key, score, true
+		}
+	}
+	return best, found
+}
+
+// Families list the font family names of the Cache
+func (c Cache) Families() (names []string) {
+	for _, f := range c {
+		for _, family := range familyNames(f.Font) {
+			names = appendUnique(names, family)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Similar list up to 5 family names close to name,
+// the closest first
+func (c Cache) Similar(name string) []string {
+	return similar(c.Families(), name)
+}
+
+// similar list up to 5 of the families close to name, the closest first
+func similar(families []string, name string) []string {
+	type match struct {
+		name string
+		dist int
+	}
+	query := strings.ToLower(name)
+	var matches []match
+	for _, family := range families {
+		key := strings.ToLower(family)
+		dist := levenshtein(query, key)
+		if strings.Contains(key, query) || strings.Contains(query, key) {
+			// "Arial" for "Arial Black", "Noto Sans" for "Noto"
+			dist = 0
+		}
+		if dist <= len(query)/3 {
+			matches = append(matches, match{family, dist})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].dist < matches[j].dist
+	})
+	var names []string
+	for i, m := range matches {
+		if i == maxSimilar {
+			break
+		}
+		names = append(names, m.name)
+	}
+	return names
+}
+
+// levenshtein edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 // func expandUser(path string) (expandedPath string) {
@@ -0,0 +1,257 @@
+package fontcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testFamily the family of utils/testdata/eyecandy-test.ttf
+const testFamily = "Eyecandy Test"
+
+// testFont read the test font
+func testFont(t *testing.T) []byte {
+	t.Helper()
+	src, err := ioutil.ReadFile(
+		filepath.Join("..", "utils", "testdata", "eyecandy-test.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+// styledFont a copy of the test font with the weight and fsSelection
+// of its OS/2 table changed
+func styledFont(t *testing.T, weight int, selection uint16) []byte {
+	t.Helper()
+	src := testFont(t)
+	os2 := os2Table(src, 0)
+	if len(os2) < 64 {
+		t.Fatal("the test font has no OS/2 table")
+	}
+	binary.BigEndian.PutUint16(os2[4:], uint16(weight))
+	binary.BigEndian.PutUint16(os2[62:], selection)
+	return src
+}
+
+// collection join fonts in a collection (.ttc), moving the offsets
+// of their tables after the header
+func collection(fonts ...[]byte) []byte {
+	header := 12 + 4*len(fonts)
+	src := make([]byte, header)
+	copy(src, "ttcf")
+	binary.BigEndian.PutUint32(src[4:], 0x00010000)
+	binary.BigEndian.PutUint32(src[8:], uint32(len(fonts)))
+	for i, f := range fonts {
+		for len(src)%4 != 0 {
+			src = append(src, 0)
+		}
+		base := len(src)
+		binary.BigEndian.PutUint32(src[12+4*i:], uint32(base))
+		src = append(src, f...)
+		numTables := int(binary.BigEndian.Uint16(f[4:]))
+		for j := 0; j < numTables; j++ {
+			rec := src[base+12+16*j:]
+			binary.BigEndian.PutUint32(rec[8:],
+				binary.BigEndian.Uint32(rec[8:])+uint32(base))
+		}
+	}
+	return src
+}
+
+// writeFile write a file in dir, creating the directories of the name
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSystemFontPaths(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("XDG font directories")
+	}
+	tests := []struct {
+		env  map[string]string
+		want []string
+	}{
+		{
+			map[string]string{},
+			[]string{"/home/u/.local/share/fonts", "/home/u/.fonts",
+				"/usr/local/share/fonts", "/usr/share/fonts",
+				"/usr/X11R6/lib/X11/fonts"},
+		},
+		{
+			map[string]string{
+				"XDG_DATA_HOME": "/data", "XDG_DATA_DIRS": "/a:/b"},
+			[]string{"/data/fonts", "/home/u/.fonts", "/a/fonts", "/b/fonts",
+				"/usr/X11R6/lib/X11/fonts"},
+		},
+		{
+			map[string]string{EnvFontPath: "/x:/y/z"},
+			[]string{"/x", "/y/z"},
+		},
+	}
+	for _, tt := range tests {
+		t.Setenv("HOME", "/home/u")
+		for _, key := range []string{
+			EnvFontPath, "XDG_DATA_HOME", "XDG_DATA_DIRS"} {
+			t.Setenv(key, tt.env[key])
+		}
+		if got := SystemFontPaths(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: SystemFontPaths() = %q, want %q",
+				tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestCacheInit(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	font := writeFile(t, dir, "sub/dir/eyecandy-test.ttf", testFont(t))
+	writeFile(t, dir, "readme.txt", []byte("not a font"))
+	broken := writeFile(t, dir, "broken.otf", []byte("not a font"))
+	t.Setenv(EnvFontPath, dir+string(os.PathListSeparator)+
+		filepath.Join(dir, "missing"))
+
+	c := New()
+	c.Init(SystemFontPaths())
+	f, err := c.Find(strings.ToUpper(testFamily), WeightBold, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Path != font || f.Family != testFamily || f.Weight != WeightRegular {
+		t.Errorf("Find = %s %q %d, want %s %q %d", f.Path, f.Family,
+			f.Weight, font, testFamily, WeightRegular)
+	}
+	if f.Ascent != 900 || f.Descent != 300 {
+		t.Errorf("Ascent, Descent = %d, %d, want 900, 300",
+			f.Ascent, f.Descent)
+	}
+	if got := c.Families(); !reflect.DeepEqual(got, []string{testFamily}) {
+		t.Errorf("Families() = %q, want %q", got, []string{testFamily})
+	}
+	if !strings.Contains(logged.String(), "skipping "+broken) {
+		t.Errorf("the broken font isn't logged: %q", logged.String())
+	}
+}
+
+func TestCacheFind(t *testing.T) {
+	dir := t.TempDir()
+	regular := writeFile(t, dir, "regular.ttf", testFont(t))
+	bold := writeFile(t, dir, "bold.otf", styledFont(t, WeightBold, fsBold))
+	// the italic and an oblique with an old 1-9 weight
+	ttc := writeFile(t, dir, "italic.ttc", collection(
+		styledFont(t, WeightRegular, fsItalic), styledFont(t, 9, fsOblique)))
+
+	c := New()
+	c.Init([]string{dir})
+	tests := []struct {
+		weight int
+		italic bool
+		path   string
+		index  int
+	}{
+		{WeightRegular, false, regular, 0},
+		{WeightLight, false, regular, 0},
+		{WeightBold, false, bold, 0},
+		{WeightSemiBold, false, bold, 0},
+		{WeightBlack, false, bold, 0},
+		{WeightRegular, true, ttc, 0},
+		{WeightMedium, true, ttc, 0},
+		{WeightBold, true, ttc, 1},
+		{WeightExtraBold, true, ttc, 1},
+	}
+	for _, tt := range tests {
+		f, err := c.Find(testFamily, tt.weight, tt.italic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Path != tt.path || f.Index != tt.index {
+			t.Errorf("Find(%d, %t) = %s %d, want %s %d", tt.weight,
+				tt.italic, f.Path, f.Index, tt.path, tt.index)
+		}
+	}
+	f, err := c.Find(testFamily, WeightBlack, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Weight != WeightBlack || !f.Italic || f.Family != testFamily {
+		t.Errorf("oblique face: %q weight %d, italic %t", f.Family,
+			f.Weight, f.Italic)
+	}
+
+	for b, want := range map[int]int{
+		0: WeightRegular, 1: WeightBold, -1: WeightBold, 300: WeightLight} {
+		if got := Weight(b); got != want {
+			t.Errorf("Weight(%d) = %d, want %d", b, got, want)
+		}
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	c := New()
+	if err := c.Add("eyecandy-test.ttf", testFont(t)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		similar []string
+	}{
+		{"Eyecandy Tset", []string{testFamily}},
+		{"eyecandy", []string{testFamily}},
+		{"Eyecandy Test Bold", []string{testFamily}},
+		{"Arial", nil},
+	}
+	for _, tt := range tests {
+		_, err := c.Find(tt.name, WeightRegular, false)
+		var nf *NotFoundError
+		if !errors.As(err, &nf) {
+			t.Errorf("Find(%q) error = %v, want a *NotFoundError",
+				tt.name, err)
+			continue
+		}
+		if nf.Name != tt.name || !reflect.DeepEqual(nf.Similar, tt.similar) {
+			t.Errorf("Find(%q) = %q %q, want %q %q", tt.name, nf.Name,
+				nf.Similar, tt.name, tt.similar)
+		}
+	}
+
+	err := &NotFoundError{Name: "Arail", Similar: []string{"Arial", "Arimo"}}
+	want := `fontcache: font not found "Arail", did you mean Arial, Arimo?`
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+
+	families := []string{"Arial", "Arial Black", "Arimo", "Noto Sans",
+		"Noto Serif", "Times New Roman"}
+	for _, tt := range []struct {
+		name string
+		want []string
+	}{
+		{"arial", []string{"Arial", "Arial Black"}},
+		{"Ariel", []string{"Arial"}},
+		{"Noto", []string{"Noto Sans", "Noto Serif"}},
+		{"Comic Sans", nil},
+	} {
+		if got := similar(families, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("similar(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package fontcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EnvFontIndex environment variable with the path of the on-disk font
+// index used by Default (no index file if it's empty)
+const EnvFontIndex = "EYECANDY_FONT_INDEX"
+
+// indexVersion version of the on-disk index format
+const indexVersion = 1
+
+// Face a face of a font file, as stored in the index
+type Face struct {
+	Index    int      `json:"index"`
+	Families []string `json:"families"`
+	Weight   int      `json:"weight"`
+	Italic   bool     `json:"italic"`
+}
+
+// FileEntry a font file of the index
+type FileEntry struct {
+	Path    string `json:"path"`
+	ModTime int64  `json:"mtime"` // unix nanoseconds
+	Size    int64  `json:"size"`
+	Faces   []Face `json:"faces"` // empty if the file can't be parsed
+}
+
+// indexFile the on-disk index
+type indexFile struct {
+	Version int          `json:"version"`
+	Files   []*FileEntry `json:"files"`
+}
+
+// faceRef a face of a font file
+type faceRef struct {
+	path  string
+	index int
+}
+
+// Library a concurrency-safe font cache, the font directories are
+// scanned once and each font file is parsed at most once, when a face
+// of it is requested. The faces found can be kept in an on-disk index,
+// so only the new or modified files are parsed in the next runs.
+type Library struct {
+	Paths     []string // font directories
+	IndexFile string   // on-disk index, "" to keep it only in memory
+
+	mu       sync.Mutex
+	embedded Cache // fonts added with AddFont, searched first
+	scanned  bool
+	files    []*FileEntry          // in scan order
+	faces    map[Key]faceRef       // the first face found for each Key
+	loaded   map[string][]*Font    // parsed font files, by path
+	byPath   map[string]*FileEntry // files of the index, by path
+	changed  bool                  // the index need to be saved
+}
+
+// NewLibrary create a Library of the fonts of paths
+func NewLibrary(paths []string, indexFile string) *Library {
+	return &Library{Paths: paths, IndexFile: indexFile}
+}
+
+// Default the process-wide Library of the system fonts
+var Default = NewLibrary(FontPaths, os.Getenv(EnvFontIndex))
+
+// Find get the face of a font family closest to the weight and italic
+// wanted (see Cache.Find), scanning the font directories the first time.
+func (l *Library) Find(name string, weight int, italic bool) (*Font, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.embedded) > 0 {
+		if f, err := l.embedded.Find(name, weight, italic); err == nil {
+			return f, nil
+		}
+	}
+	l.scan()
+	keys := make([]Key, 0, len(l.faces))
+	for key := range l.faces {
+		keys = append(keys, key)
+	}
+	key, ok := bestKey(keys, name, weight, italic)
+	if !ok {
+		return nil, &NotFoundError{Name: name, Similar: l.similar(name)}
+	}
+	ref := l.faces[key]
+	fonts, err := l.load(ref.path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fonts {
+		if f.Index == ref.index {
+			return f, nil
+		}
+	}
+	return nil, fmt.Errorf("fontcache: %s: face %d not found",
+		ref.path, ref.index)
+}
+
+// AddFont add a font file in memory (e.g. embedded in a script),
+// its families are searched before the fonts of the directories.
+func (l *Library) AddFont(name string, src []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.embedded == nil {
+		l.embedded = New()
+	}
+	if err := l.embedded.Add(name, src); err != nil {
+		return fmt.Errorf("fontcache: %s: %s", name, err)
+	}
+	return nil
+}
+
+// Families list the font family names of the Library
+func (l *Library) Families() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.scan()
+	return l.families()
+}
+
+// Rescan scan again the font directories in the next Find
+func (l *Library) Rescan() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.scanned = false
+}
+
+func (l *Library) families() (names []string) {
+	names = l.embedded.Families()
+	for _, fe := range l.files {
+		for _, face := range fe.Faces {
+			for _, family := range face.Families {
+				names = appendUnique(names, family)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *Library) similar(name string) []string {
+	return similar(l.families(), name)
+}
+
+// load parse a font file, only the first time
+func (l *Library) load(path string) ([]*Font, error) {
+	if fonts, ok := l.loaded[path]; ok {
+		return fonts, nil
+	}
+	fonts, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	l.loaded[path] = fonts
+	return fonts, nil
+}
+
+// parseFile read and parse a font file
+func parseFile(path string) ([]*Font, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("fontcache: %s", err)
+	}
+	fonts, err := ParseFonts(path, src)
+	if err != nil {
+		return nil, fmt.Errorf("fontcache: %s: %s", path, err)
+	}
+	return fonts, nil
+}
+
+// scan walk the font directories, parsing only the files
+// not in the index or modified since it was saved
+func (l *Library) scan() {
+	if l.scanned {
+		return
+	}
+	l.scanned = true
+	if l.loaded == nil {
+		l.loaded = make(map[string][]*Font)
+	}
+	if l.byPath == nil {
+		l.byPath = make(map[string]*FileEntry)
+		l.readIndex()
+	}
+
+	old := l.byPath
+	l.byPath = make(map[string]*FileEntry)
+	l.files = nil
+	l.faces = make(map[Key]faceRef)
+	for _, dir := range l.Paths {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !isFontFile(path) {
+				return nil
+			}
+			if _, ok := l.byPath[path]; ok {
+				// directories listed twice
+				return nil
+			}
+			fe, ok := old[path]
+			if !ok || fe.ModTime != info.ModTime().UnixNano() ||
+				fe.Size != info.Size() {
+				fe = l.parseEntry(path, info)
+				l.changed = true
+			}
+			l.addEntry(fe)
+			return nil
+		})
+	}
+	if len(old) != len(l.byPath) {
+		// removed files
+		l.changed = true
+	}
+	l.writeIndex()
+}
+
+// parseEntry parse a font file to create its index entry, the fonts
+// aren't kept (only Find keep the files it use)
+func (l *Library) parseEntry(path string, info os.FileInfo) *FileEntry {
+	fe := &FileEntry{
+		Path: path, ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+	delete(l.loaded, path) // the file changed
+	fonts, err := parseFile(path)
+	if err != nil {
+		log.Printf("fontcache: skipping %s", strings.TrimPrefix(
+			err.Error(), "fontcache: "))
+		return fe
+	}
+	for _, f := range fonts {
+		fe.Faces = append(fe.Faces, Face{
+			Index:    f.Index,
+			Families: familyNames(f.Font),
+			Weight:   f.Weight,
+			Italic:   f.Italic,
+		})
+	}
+	return fe
+}
+
+// addEntry add the faces of a file, keeping the first one found
+// for each Key
+func (l *Library) addEntry(fe *FileEntry) {
+	l.files = append(l.files, fe)
+	l.byPath[fe.Path] = fe
+	for _, face := range fe.Faces {
+		for _, family := range face.Families {
+			key := Key{strings.ToLower(family), face.Weight, face.Italic}
+			if _, ok := l.faces[key]; !ok {
+				l.faces[key] = faceRef{fe.Path, face.Index}
+			}
+		}
+	}
+}
+
+// readIndex load the on-disk index, a missing or invalid index is ignored
+func (l *Library) readIndex() {
+	if l.IndexFile == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(l.IndexFile)
+	if err != nil {
+		return
+	}
+	var idx indexFile
+	if err := json.Unmarshal(data, &idx); err != nil ||
+		idx.Version != indexVersion {
+		return
+	}
+	for _, fe := range idx.Files {
+		l.byPath[fe.Path] = fe
+	}
+}
+
+// writeIndex save the on-disk index if it changed
+func (l *Library) writeIndex() {
+	if l.IndexFile == "" || !l.changed {
+		return
+	}
+	data, err := json.Marshal(&indexFile{Version: indexVersion, Files: l.files})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(l.IndexFile), 0755); err != nil {
+		log.Printf("fontcache: failed saving index: %s", err)
+		return
+	}
+	// write and rename, other processes can be reading it
+	tmp := l.IndexFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("fontcache: failed saving index: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, l.IndexFile); err != nil {
+		log.Printf("fontcache: failed saving index: %s", err)
+		return
+	}
+	l.changed = false
+}
@@ -0,0 +1,226 @@
+package fontcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// readIndexFile read the entries of an on-disk index, by path
+func readIndexFile(t *testing.T, fn string) map[string]*FileEntry {
+	t.Helper()
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idx indexFile
+	if err := json.Unmarshal(data, &idx); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Version != indexVersion {
+		t.Errorf("index version %d, want %d", idx.Version, indexVersion)
+	}
+	files := make(map[string]*FileEntry)
+	for _, fe := range idx.Files {
+		files[fe.Path] = fe
+	}
+	return files
+}
+
+// loadedPaths the font files parsed by a Library
+func loadedPaths(l *Library) (paths []string) {
+	for path := range l.loaded {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestLibraryFind(t *testing.T) {
+	dir := t.TempDir()
+	regular := writeFile(t, dir, "regular.ttf", testFont(t))
+	bold := writeFile(t, dir, "bold.ttf", styledFont(t, WeightBold, fsBold))
+	italic := writeFile(t, dir, "italic.ttf",
+		styledFont(t, WeightRegular, fsItalic))
+	black := writeFile(t, dir, "sub/black-oblique.ttf",
+		styledFont(t, 9, fsOblique)) // old 1-9 weight
+
+	l := NewLibrary([]string{dir, dir}, "")
+	if got := l.Families(); !reflect.DeepEqual(got, []string{testFamily}) {
+		t.Errorf("Families() = %q, want %q", got, []string{testFamily})
+	}
+	if len(l.loaded) != 0 {
+		t.Errorf("files parsed before Find: %q", loadedPaths(l))
+	}
+
+	// only the files of the faces found are parsed
+	tests := []struct {
+		weight int
+		italic bool
+		path   string
+	}{
+		{WeightRegular, false, regular},
+		{WeightBlack, false, bold},
+		{WeightMedium, true, italic},
+	}
+	for _, tt := range tests {
+		f, err := l.Find(testFamily, tt.weight, tt.italic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Path != tt.path {
+			t.Errorf("Find(%d, %t) = %s, want %s", tt.weight, tt.italic,
+				f.Path, tt.path)
+		}
+	}
+	want := []string{bold, italic, regular}
+	if got := loadedPaths(l); !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed files %q, want %q", got, want)
+	}
+	if f, err := l.Find(testFamily, WeightBold, true); err != nil ||
+		f.Path != black || f.Weight != WeightBlack {
+		t.Errorf("Find(%d, true) = %v, %v, want %s", WeightBold, f, err,
+			black)
+	}
+
+	if _, err := l.Find("Eyecandy Tset", WeightRegular, false); err == nil {
+		t.Error("Find of a missing family: no error")
+	} else if nf, ok := err.(*NotFoundError); !ok ||
+		!reflect.DeepEqual(nf.Similar, []string{testFamily}) {
+		t.Errorf("Find of a missing family: error %v", err)
+	}
+
+	// the fonts added in memory are searched first
+	if err := l.AddFont("embedded.ttf", testFont(t)); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := l.Find(testFamily, WeightBold, false); err != nil ||
+		f.Path != "embedded.ttf" {
+		t.Errorf("Find after AddFont = %v, %v, want embedded.ttf", f, err)
+	}
+	if err := l.AddFont("broken.ttf", []byte("not a font")); err == nil {
+		t.Error("AddFont of a broken font: no error")
+	}
+}
+
+func TestLibraryIndex(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	index := filepath.Join(t.TempDir(), "cache", "fonts.json")
+	regular := writeFile(t, dir, "regular.ttf", testFont(t))
+	bold := writeFile(t, dir, "bold.ttf", styledFont(t, WeightBold, fsBold))
+	broken := writeFile(t, dir, "broken.otf", []byte("not a font"))
+
+	l := NewLibrary([]string{dir}, index)
+	if _, err := l.Find(testFamily, WeightBold, false); err != nil {
+		t.Fatal(err)
+	}
+	files := readIndexFile(t, index)
+	if len(files) != 3 {
+		t.Fatalf("%d files in the index, want 3", len(files))
+	}
+	for path, want := range map[string][]Face{
+		regular: {{0, []string{testFamily}, WeightRegular, false}},
+		bold:    {{0, []string{testFamily}, WeightBold, false}},
+		broken:  nil,
+	} {
+		if got := files[path].Faces; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: faces %v, want %v", path, got, want)
+		}
+	}
+
+	// the files of the index aren't parsed again: a file with the same
+	// size and time is trusted, even if it's broken now
+	info, err := os.Stat(regular)
+	if err != nil {
+		t.Fatal(err)
+	}
+	garbage := bytes.Repeat([]byte{'x'}, int(info.Size()))
+	if err := ioutil.WriteFile(regular, garbage, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(regular, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	logged.Reset()
+	l = NewLibrary([]string{dir}, index)
+	f, err := l.Find(testFamily, WeightBold, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Path != bold {
+		t.Errorf("Find = %s, want %s", f.Path, bold)
+	}
+	if got := loadedPaths(l); !reflect.DeepEqual(got, []string{bold}) {
+		t.Errorf("parsed files %q, want %q", got, []string{bold})
+	}
+	if logged.Len() != 0 {
+		t.Errorf("files parsed again: %q", logged.String())
+	}
+
+	// the modified, added and removed files update the index
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(regular, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = os.Stat(regular); err != nil {
+		t.Fatal(err)
+	}
+	italic := writeFile(t, dir, "italic.ttf",
+		styledFont(t, WeightRegular, fsItalic))
+	if err := os.Remove(bold); err != nil {
+		t.Fatal(err)
+	}
+	l.Rescan()
+	f, err = l.Find(testFamily, WeightBold, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Path != italic {
+		t.Errorf("Find after Rescan = %s, want %s", f.Path, italic)
+	}
+	if !bytes.Contains(logged.Bytes(), []byte("skipping "+regular)) {
+		t.Errorf("the modified file isn't parsed again: %q", logged.String())
+	}
+	files = readIndexFile(t, index)
+	if files[bold] != nil || files[italic] == nil || len(files) != 3 ||
+		files[regular].Faces != nil ||
+		files[regular].ModTime != info.ModTime().UnixNano() {
+		t.Errorf("index after Rescan: %v", files)
+	}
+
+	// an unchanged index isn't saved again
+	stat, err := os.Stat(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Rescan()
+	l.Families()
+	if last, err := os.Stat(index); err != nil ||
+		last.ModTime() != stat.ModTime() {
+		t.Errorf("the unchanged index is saved again: %v", err)
+	}
+
+	// an invalid index is ignored and replaced
+	if err := ioutil.WriteFile(index, []byte(`{"version": 0}`),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+	l = NewLibrary([]string{dir}, index)
+	if got := l.Families(); !reflect.DeepEqual(got, []string{testFamily}) {
+		t.Errorf("Families() with an invalid index = %q", got)
+	}
+	if files := readIndexFile(t, index); len(files) != 3 {
+		t.Errorf("%d files in the new index, want 3", len(files))
+	}
+}
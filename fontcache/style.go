@@ -0,0 +1,144 @@
+package fontcache
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// Font weights (OS/2 usWeightClass)
+const (
+	WeightThin       = 100
+	WeightExtraLight = 200
+	WeightLight      = 300
+	WeightRegular    = 400
+	WeightMedium     = 500
+	WeightSemiBold   = 600
+	WeightBold       = 700
+	WeightExtraBold  = 800
+	WeightBlack      = 900
+)
+
+// OS/2 fsSelection flags
+const (
+	fsItalic  = 1 << 0
+	fsBold    = 1 << 5
+	fsOblique = 1 << 9
+)
+
+// faceOffsets the offsets of the table directory of each face,
+// a collection (.ttc) has a list of them in its header
+func faceOffsets(src []byte) []int {
+	if len(src) < 12 {
+		return nil
+	}
+	if string(src[:4]) != "ttcf" {
+		return []int{0}
+	}
+	n := int(binary.BigEndian.Uint32(src[8:]))
+	var offsets []int
+	for i := 0; i < n && 16+4*i <= len(src); i++ {
+		offsets = append(offsets, int(binary.BigEndian.Uint32(src[12+4*i:])))
+	}
+	return offsets
+}
+
+// os2Table find the OS/2 table of a face, nil if it's missing
+func os2Table(src []byte, offset int) []byte {
+	if offset+12 > len(src) {
+		return nil
+	}
+	numTables := int(binary.BigEndian.Uint16(src[offset+4:]))
+	for i := 0; i < numTables; i++ {
+		rec := offset + 12 + 16*i
+		if rec+16 > len(src) {
+			return nil
+		}
+		if string(src[rec:rec+4]) != "OS/2" {
+			continue
+		}
+		table := int(binary.BigEndian.Uint32(src[rec+8:]))
+		length := int(binary.BigEndian.Uint32(src[rec+12:]))
+		if table+length > len(src) {
+			return nil
+		}
+		return src[table : table+length]
+	}
+	return nil
+}
+
+// os2Style read the weight and italic of a face from its OS/2 table,
+// the weight is zero if the table is missing
+func os2Style(os2 []byte) (weight int, italic bool) {
+	if len(os2) < 64 {
+		return 0, false
+	}
+	weight = int(binary.BigEndian.Uint16(os2[4:]))
+	selection := binary.BigEndian.Uint16(os2[62:])
+	if weight < WeightThin || weight > WeightBlack {
+		// some old fonts use 1-9
+		weight *= 100
+		if weight < WeightThin || weight > WeightBlack {
+			weight = WeightRegular
+			if selection&fsBold != 0 {
+				weight = WeightBold
+			}
+		}
+	}
+	return weight, selection&(fsItalic|fsOblique) != 0
+}
+
+// os2Height read the usWinAscent and usWinDescent of a face (font units),
+// the height used by GDI, VSFilter and libass to scale the font size
+func os2Height(os2 []byte) (ascent, descent int) {
+	if len(os2) < 78 {
+		return 0, 0
+	}
+	return int(binary.BigEndian.Uint16(os2[74:])),
+		int(binary.BigEndian.Uint16(os2[76:]))
+}
+
+// subfamilyWeights weights by subfamily name, the longest names first
+var subfamilyWeights = []struct {
+	name   string
+	weight int
+}{
+	{"extralight", WeightExtraLight}, {"ultralight", WeightExtraLight},
+	{"extrabold", WeightExtraBold}, {"ultrabold", WeightExtraBold},
+	{"semibold", WeightSemiBold}, {"demibold", WeightSemiBold},
+	{"hairline", WeightThin}, {"medium", WeightMedium},
+	{"black", WeightBlack}, {"heavy", WeightBlack},
+	{"light", WeightLight}, {"thin", WeightThin},
+	{"bold", WeightBold},
+}
+
+// nameStyle guess the weight and italic of a face from its subfamily name
+func nameStyle(f *sfnt.Font) (weight int, italic bool) {
+	sub, err := f.Name(nil, sfnt.NameIDTypographicSubfamily)
+	if err != nil || sub == "" {
+		sub, _ = f.Name(nil, sfnt.NameIDSubfamily)
+	}
+	sub = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(sub))
+	weight = WeightRegular
+	for _, sw := range subfamilyWeights {
+		if strings.Contains(sub, sw.name) {
+			weight = sw.weight
+			break
+		}
+	}
+	return weight, strings.Contains(sub, "italic") ||
+		strings.Contains(sub, "oblique")
+}
+
+// Weight get the weight of a \b tag value or a Style Bold field:
+// 0 is regular, 1 is bold and 100-900 a weight
+func Weight(b int) int {
+	switch {
+	case b == 0:
+		return WeightRegular
+	case b == 1 || b == -1:
+		return WeightBold
+	}
+	return b
+}
@@ -0,0 +1,52 @@
+package eyecandy
+
+import (
+	"github.com/Alquimista/eyecandy/asstime"
+)
+
+// Frame a video frame where a Dialog is displayed, see Dialog.Frames
+type Frame struct {
+	N         int // of the frame in the Dialog, from 0
+	Frame     int // of the video
+	StartTime asstime.Time
+	EndTime   asstime.Time
+	T         float64 // progress of the Dialog, 0 in the first frame and 1 in the last
+}
+
+// Frames split the time of the Dialog in the frames of the video where
+// it's displayed, one line for each Frame shows it frame by frame. The
+// times are the middle between two frames (like Timecodes.Snap), the
+// end of a Frame is the start of the next one, so there are no gaps or
+// overlaps. The first and the last Frame don't go out of the Dialog.
+func (d *Dialog) Frames(tc *asstime.Timecodes) (frames []Frame) {
+	first := tc.MsToFrame(d.StartTime.MS(), asstime.Start)
+	last := tc.MsToFrame(d.EndTime.MS(), asstime.End)
+	for f := first; f <= last; f++ {
+		t := 0.0
+		if last > first {
+			t = float64(f-first) / float64(last-first)
+		}
+		frames = append(frames, Frame{
+			N:         f - first,
+			Frame:     f,
+			StartTime: asstime.Time(tc.FrameToMs(f, asstime.Start)),
+			EndTime:   asstime.Time(tc.FrameToMs(f, asstime.End)),
+			T:         t,
+		})
+	}
+	if n := len(frames); n > 0 {
+		if frames[0].StartTime < d.StartTime {
+			frames[0].StartTime = d.StartTime
+		}
+		if frames[n-1].EndTime > d.EndTime {
+			frames[n-1].EndTime = d.EndTime
+		}
+	}
+	return frames
+}
+
+// FramesFPS split the time of the Dialog in the frames of a video with
+// a constant frame rate, see Frames
+func (d *Dialog) FramesFPS(framerate float64) []Frame {
+	return d.Frames(asstime.NewTimecodes(framerate))
+}
@@ -0,0 +1,101 @@
+package eyecandy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Alquimista/eyecandy/asstime"
+)
+
+func TestFrames(t *testing.T) {
+	cfr := asstime.NewTimecodes(asstime.FpsPal)
+	// frames 0, 40, 100, 150, then the average rate (20 fps)
+	v2, err := asstime.ParseTimecodes(strings.NewReader(
+		"# timecode format v2\n0\n40\n100\n150\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		tc          *asstime.Timecodes
+		start, end  asstime.Time
+		first, last int // frames, last < first if none
+		wantStarts  []asstime.Time
+	}{
+		// the first frame starts at -20 and the last ends at 980
+		{"cfr", cfr, 0, 1000, 0, 24, nil},
+		// the first frame starts at 20 and the last ends at 980
+		{"cfr clamped", cfr, 30, 961, 1, 24, nil},
+		{"cfr one frame", cfr, 40, 80, 1, 1, []asstime.Time{40}},
+		{"cfr no frame", cfr, 41, 79, 2, 1, nil},
+		{"v2", v2, 0, 200, 0, 3, []asstime.Time{0, 20, 70, 125}},
+		{"v2 clamped", v2, 30, 170, 1, 3, []asstime.Time{30, 70, 125}},
+	}
+	for _, tt := range tests {
+		d := &Dialog{StartTime: tt.start, EndTime: tt.end}
+		frames := d.Frames(tt.tc)
+		n := tt.last - tt.first + 1
+		if n < 0 {
+			n = 0
+		}
+		if len(frames) != n {
+			t.Errorf("%s: %d frames, want %d", tt.name, len(frames), n)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		first, last := frames[0], frames[len(frames)-1]
+		if first.Frame != tt.first || last.Frame != tt.last {
+			t.Errorf("%s: frames %d-%d, want %d-%d", tt.name,
+				first.Frame, last.Frame, tt.first, tt.last)
+		}
+		if first.StartTime != tt.start {
+			t.Errorf("%s: first frame start %d, want %d (the Dialog start)",
+				tt.name, first.StartTime, tt.start)
+		}
+		if last.EndTime > tt.end {
+			t.Errorf("%s: last frame end %d, after the Dialog end %d",
+				tt.name, last.EndTime, tt.end)
+		}
+		if first.T != 0 || n > 1 && last.T != 1 {
+			t.Errorf("%s: T = %g in the first frame and %g in the last, "+
+				"want 0 and 1", tt.name, first.T, last.T)
+		}
+		for i, f := range frames {
+			if f.N != i || f.Frame != tt.first+i {
+				t.Errorf("%s: frame %d: N %d, Frame %d", tt.name, i, f.N,
+					f.Frame)
+			}
+			if f.EndTime <= f.StartTime {
+				t.Errorf("%s: frame %d: empty %d-%d", tt.name, i,
+					f.StartTime, f.EndTime)
+			}
+			if i > 0 && f.StartTime != frames[i-1].EndTime {
+				t.Errorf("%s: frame %d starts at %d, the previous ends at %d",
+					tt.name, i, f.StartTime, frames[i-1].EndTime)
+			}
+			if i > 0 && f.T <= frames[i-1].T {
+				t.Errorf("%s: frame %d: T %g after %g", tt.name, i, f.T,
+					frames[i-1].T)
+			}
+			if tt.wantStarts != nil && f.StartTime != tt.wantStarts[i] {
+				t.Errorf("%s: frame %d starts at %d, want %d", tt.name, i,
+					f.StartTime, tt.wantStarts[i])
+			}
+			// every frame is displayed between its times
+			ms := tt.tc.FrameToMs(f.Frame, asstime.Exact)
+			if ms < f.StartTime.MS() || ms >= f.EndTime.MS() {
+				t.Errorf("%s: frame %d displayed at %d, out of %d-%d",
+					tt.name, i, ms, f.StartTime, f.EndTime)
+			}
+		}
+	}
+
+	d := &Dialog{StartTime: 30, EndTime: 961}
+	if got, want := d.FramesFPS(asstime.FpsPal), d.Frames(cfr); len(got) !=
+		len(want) || got[0] != want[0] || got[len(got)-1] != want[len(want)-1] {
+		t.Errorf("FramesFPS = %v, want like Frames %v", got, want)
+	}
+}
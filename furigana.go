@@ -0,0 +1,254 @@
+package eyecandy
+
+import (
+	"math"
+	"strings"
+
+	"github.com/Alquimista/eyecandy/draw"
+	"github.com/Alquimista/eyecandy/reader"
+)
+
+// DefaultFuriScale size of the furigana from the size of the text
+const DefaultFuriScale = 0.5
+
+// Word a group of syllables between spaces
+type Word struct {
+	Dialog
+	SylN  int
+	line  *Line
+	first int // index of the first and last char in the Line layout
+	last  int
+}
+
+// Shape convert the text of the Word into a vector drawing,
+// drawn with \an7\pos(Left,Top) it replace the text in place
+func (w *Word) Shape() (*draw.Shape, error) {
+	return w.line.glyphsShape(w.first, w.last)
+}
+
+// Furi a furigana (ruby) of a syllable, laid out above its base text
+// in the furigana style of the Line style (see Script.FuriScale)
+type Furi struct {
+	Dialog
+	Inline string
+	Kind   string
+	Base   string // the base text, shared with the "#|" syllables
+	span   *spanStyle
+	line   *Line
+}
+
+// Shape convert the Furi into a vector drawing,
+// drawn with \an7\pos(Left,Top) it replace the text in place
+func (f *Furi) Shape() (*draw.Shape, error) {
+	shape, err := f.span.shape(f.Text, f.line.kerning)
+	if err != nil {
+		return nil, err
+	}
+	height := f.span.ascent + f.span.descent
+	return f.line.layout.rotateShape(shape, height), nil
+}
+
+// furiPart the layout of the furigana of a syllable
+type furiPart struct {
+	syl   int
+	base  string
+	left  float64 // from the left of the row
+	width float64
+	row   int
+	span  *spanStyle
+}
+
+// wordBreak get if there is a space or a row break
+// between the chars a and b
+func (l *layout) wordBreak(a, b int) bool {
+	if l.glyphs[a].row != l.glyphs[b].row {
+		return true
+	}
+	for _, g := range l.glyphs[a+1 : b] {
+		if g.space || g.newline {
+			return true
+		}
+	}
+	return false
+}
+
+// Words list the words of a Line, the syllables grouped by spaces
+func (d *Line) Words() (words []*Word) {
+	var group []*Syl
+	flush := func() {
+		if len(group) == 0 {
+			return
+		}
+		first, last := group[0], group[len(group)-1]
+		width := last.Right - first.Left
+		x, y := alignPoint(d.Style.Alignment, first.Left,
+			first.Left+width/2.0, last.Right, first.Top, first.Middle,
+			first.Bottom)
+		duration := last.EndTime - first.StartTime
+		words = append(words, &Word{
+			Dialog: Dialog{
+				Layer:     d.Layer,
+				Style:     d.Style,
+				StyleName: d.StyleName,
+				Actor:     d.Actor,
+				Margin:    d.Margin,
+				Effect:    d.Effect,
+				Tags:      d.Tags,
+				Comment:   d.Comment,
+				StartTime: first.StartTime,
+				EndTime:   last.EndTime,
+				Duration:  duration,
+				MidTime:   first.StartTime + duration/2,
+				Text:      d.sylText(first.first, last.last),
+				Width:     width,
+				Height:    first.Height,
+				Size:      [2]float64{width, first.Height},
+				X:         x,
+				Y:         y,
+				Top:       first.Top,
+				Middle:    first.Middle,
+				Bottom:    first.Bottom,
+				Left:      first.Left,
+				Center:    first.Left + width/2.0,
+				Right:     last.Right,
+			},
+			SylN:  len(group),
+			line:  d,
+			first: first.first,
+			last:  last.last,
+		})
+		d.layout.orient(&words[len(words)-1].Dialog)
+		group = nil
+	}
+
+	syls := d.syllables()
+	for i, s := range syls {
+		if i > 0 && d.layout.wordBreak(syls[i-1].last, s.first) {
+			flush()
+		}
+		group = append(group, s)
+	}
+	flush()
+	return words
+}
+
+// furiStyle derive the furigana style of a Style, scaled by scale
+func furiStyle(style *reader.Style, scale float64) *reader.Style {
+	furi := *style
+	furi.Name = style.Name + "-furigana"
+	furi.FontSize = int(math.Round(float64(style.FontSize) * scale))
+	furi.Bord = style.Bord * scale
+	furi.Shadow = style.Shadow * scale
+	return &furi
+}
+
+// layoutFuri lay out the furigana of the syllables: the furigana of a
+// base text and the "#|" syllables after it are centered over it, in
+// the style of the base text scaled by scale
+func layoutFuri(l *layout, syls []*karaSyl, fonts fontLoader,
+	scale float64, kerning bool) (parts []*furiPart) {
+
+	for i := 0; i < len(syls); i++ {
+		if syls[i].furiJoin {
+			continue
+		}
+		// the group of the base text
+		group := []int{}
+		if syls[i].furi != "" {
+			group = append(group, i)
+		}
+		j := i + 1
+		for ; j < len(syls) && syls[j].furiJoin; j++ {
+			if syls[j].furi != "" {
+				group = append(group, j)
+			}
+		}
+		spans := l.spans(i)
+		if len(group) == 0 || len(spans) == 0 {
+			continue
+		}
+		// over the first row of a broken syllable
+		first, last := spans[0][0], spans[0][1]
+
+		g := l.glyphs[first]
+		span := *g.span
+		span.size *= scale
+		span.load(fonts, g.span)
+
+		base := strings.TrimSpace(syls[i].text)
+		baseLeft := g.x
+		baseWidth := l.glyphs[last].x + l.glyphs[last].width - g.x
+		total := 0.0
+		var groupParts []*furiPart
+		for _, n := range group {
+			width := span.width(syls[n].furi, kerning)
+			groupParts = append(groupParts, &furiPart{
+				syl: n, base: base, left: total, width: width,
+				row: g.row, span: &span,
+			})
+			total += width
+		}
+		for _, p := range groupParts {
+			p.left += baseLeft + baseWidth/2.0 - total/2.0
+		}
+		parts = append(parts, groupParts...)
+	}
+	return parts
+}
+
+// Furi list the furigana of the syllables of a Line,
+// laid out above their base text
+func (d *Line) Furi() (furi []*Furi) {
+	for _, p := range d.furi {
+		ks := d.syls[p.syl]
+		row := d.layout.rows[p.row]
+		start := d.StartTime + ks.start
+		end := start + ks.duration
+		if p.syl == d.SylN-1 {
+			end = d.EndTime
+		}
+
+		left := row.Left + p.left
+		height := p.span.ascent + p.span.descent
+		bottom := row.Top
+		top := bottom - height
+		x, y := alignPoint(d.Style.Alignment, left, left+p.width/2.0,
+			left+p.width, top, top+height/2.0, bottom)
+
+		furi = append(furi, &Furi{
+			Dialog: Dialog{
+				Layer:     d.Layer,
+				Style:     d.furiStyle,
+				StyleName: d.furiStyle.Name,
+				Actor:     d.Actor,
+				Margin:    d.Margin,
+				Effect:    d.Effect,
+				Tags:      d.Tags,
+				Comment:   d.Comment,
+				StartTime: start,
+				EndTime:   end,
+				Duration:  end - start,
+				MidTime:   start + (end-start)/2,
+				Text:      ks.furi,
+				Width:     p.width,
+				Height:    height,
+				Size:      [2]float64{p.width, height},
+				X:         x,
+				Y:         y,
+				Top:       top,
+				Middle:    top + height/2.0,
+				Bottom:    bottom,
+				Left:      left,
+				Center:    left + p.width/2.0,
+				Right:     left + p.width,
+			},
+			Inline: ks.inline,
+			Kind:   ks.kind,
+			Base:   p.base,
+			span:   p.span,
+			line:   d,
+		})
+		d.layout.orient(&furi[len(furi)-1].Dialog)
+	}
+	return furi
+}
@@ -0,0 +1,168 @@
+package eyecandy
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Alquimista/eyecandy/asstags"
+	"github.com/Alquimista/eyecandy/asstime"
+)
+
+// Karaoke kinds of a syllable, the \K tag is a \kf. A \kt syllable
+// start at the time of the tag (from the start of the line) and has no
+// duration, the next syllables follow it.
+const (
+	KaraNormal  = "k"
+	KaraFill    = "kf"
+	KaraOutline = "ko"
+	KaraTimed   = "kt"
+)
+
+// karaSyl a karaoke syllable of the text of a Line
+type karaSyl struct {
+	kind     string
+	start    asstime.Time // from the start of the line
+	duration asstime.Time
+	inline   string // inline effect, \k20-fx or \-fx
+	override string // the other override tags, in blocks
+	text     string // without the furigana
+	furi     string // furigana of the text (kanji|reading)
+	furiJoin bool   // the furigana continue the text of the previous
+	preText  bool
+	inFuri   bool // parsing the furigana
+}
+
+// addText add a text to the syllable, after a | the text is furigana.
+// Return the text to lay out.
+func (syl *karaSyl) addText(s string) string {
+	if syl.inFuri {
+		syl.furi += s
+		return ""
+	}
+	i := strings.Index(s, "|")
+	if i < 0 {
+		syl.text += s
+		return s
+	}
+	base := s[:i]
+	syl.inFuri = true
+	syl.furi = s[i+1:]
+	if strings.TrimSpace(syl.text+base) == "#" {
+		// #|reading: more furigana of the previous text
+		syl.furiJoin = true
+		base = strings.Replace(base, "#", "", 1)
+	}
+	syl.text += base
+	return base
+}
+
+// endFuri end the furigana of the syllable, its trailing spaces are
+// spaces of the text. Return them to lay out.
+func (syl *karaSyl) endFuri() string {
+	if !syl.inFuri {
+		return ""
+	}
+	syl.inFuri = false
+	furi := strings.TrimRight(syl.furi, " ")
+	spaces := syl.furi[len(furi):]
+	syl.furi = furi
+	syl.text += spaces
+	return spaces
+}
+
+// isKaraTag get if a tag is a karaoke tag (\k, \kf, \ko, \K, \kt)
+func isKaraTag(tag *asstags.Tag) bool {
+	switch tag.Name {
+	case "k", "kf", "ko", "kt", "K":
+		return true
+	}
+	return false
+}
+
+// splitPieces split the text of a Line in pieces of text with the
+// override tags before them, and its karaoke syllables like the
+// Aegisub karaoke parser: every karaoke tag start a syllable, the text
+// before the first one is a syllable of zero duration, and the empty
+// syllables of zero duration are dropped (but the last one).
+// The furigana (kanji|reading) of the syllables and the drawings (\p1)
+// aren't laid out.
+func splitPieces(text string) (pieces []piece, syls []*karaSyl) {
+	syl := &karaSyl{kind: KaraNormal, preText: true}
+	var tags []*asstags.Tag
+	closed := -1 // length of the text when the override was closed
+	addPiece := func(s string) {
+		if s != "" {
+			pieces = append(pieces, piece{tags, s, len(syls)})
+			tags = nil
+		}
+	}
+	for _, node := range asstags.Parse(text) {
+		block, ok := node.(*asstags.Block)
+		if !ok {
+			if _, drawing := node.(*asstags.Drawing); !drawing {
+				// the drawings (\p1) aren't chars of the text
+				addPiece(syl.addText(node.String()))
+			}
+			continue
+		}
+		tags = append(tags, block.Tags...)
+
+		inTag := false
+		for _, tag := range block.Tags {
+			switch {
+			case isKaraTag(tag):
+				if inTag {
+					syl.override += "}"
+					inTag = false
+				}
+				closed = -1
+				addPiece(syl.endFuri())
+				if syl.duration > 0 || syl.text != "" || syl.furi != "" {
+					syls = append(syls, syl)
+				}
+				kind := tag.Name
+				if kind == "K" {
+					kind = KaraFill
+				}
+				value, inline := tag.Value, ""
+				if i := strings.Index(value, "-"); i >= 0 {
+					value, inline = value[:i], value[i+1:]
+				}
+				cs, _ := strconv.ParseFloat(value, 64)
+				start := syl.start + syl.duration
+				duration := asstime.Time(cs * asstime.Centisecond)
+				if kind == KaraTimed {
+					// \kt move the karaoke time to its value from the
+					// start of the line, like VSFilter
+					start, duration = duration, 0
+				}
+				syl = &karaSyl{
+					kind:     kind,
+					start:    start,
+					duration: duration,
+					inline:   inline,
+				}
+			case tag.Name == "" && strings.HasPrefix(tag.Value, `\-`):
+				syl.inline = strings.TrimPrefix(tag.Value, `\-`)
+			case tag.Name != "":
+				if !inTag {
+					if closed == len(syl.text) &&
+						strings.HasSuffix(syl.override, "}") {
+						// merge adjacent override blocks
+						syl.override = strings.TrimSuffix(syl.override, "}")
+					} else {
+						syl.override += "{"
+					}
+					inTag = true
+				}
+				syl.override += tag.String()
+			}
+		}
+		if inTag {
+			syl.override += "}"
+			closed = len(syl.text)
+		}
+	}
+	addPiece(syl.endFuri())
+	return pieces, append(syls, syl)
+}
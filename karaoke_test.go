@@ -0,0 +1,99 @@
+package eyecandy
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSplitPieces(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		syls   []karaSyl
+		pieces []string // syllable:text
+	}{
+		{
+			"\\kt",
+			`{\k10}a{\kt50}b{\k20}c`,
+			[]karaSyl{
+				{kind: KaraNormal, duration: 100, text: "a"},
+				{kind: KaraTimed, start: 500, text: "b"},
+				{kind: KaraNormal, start: 500, duration: 200, text: "c"},
+			},
+			[]string{"0:a", "1:b", "2:c"},
+		},
+		{
+			"zero duration",
+			`{\k0}{\k10}a{\k0}b{\k0}`,
+			[]karaSyl{
+				{kind: KaraNormal, duration: 100, text: "a"},
+				{kind: KaraNormal, start: 100, text: "b"},
+				{kind: KaraNormal, start: 100},
+			},
+			[]string{"0:a", "1:b"},
+		},
+		{
+			"text before the first \\k",
+			`ab {\k10}c`,
+			[]karaSyl{
+				{kind: KaraNormal, text: "ab ", preText: true},
+				{kind: KaraNormal, duration: 100, text: "c"},
+			},
+			[]string{"0:ab ", "1:c"},
+		},
+		{
+			"\\k tags in a block",
+			`{\k10\k20}a{\ko30\i1}b{\K40-glow}c`,
+			[]karaSyl{
+				{kind: KaraNormal, duration: 100},
+				{kind: KaraNormal, start: 100, duration: 200, text: "a"},
+				{kind: KaraOutline, start: 300, duration: 300, text: "b",
+					override: `{\i1}`},
+				{kind: KaraFill, start: 600, duration: 400, text: "c",
+					inline: "glow"},
+			},
+			[]string{"1:a", "2:b", "3:c"},
+		},
+		{
+			"\\k in \\t",
+			`{\k10\t(\k50\fscx120)}a{\k20}b`,
+			[]karaSyl{
+				{kind: KaraNormal, duration: 100, text: "a",
+					override: `{\t(\k50\fscx120)}`},
+				{kind: KaraNormal, start: 100, duration: 200, text: "b"},
+			},
+			[]string{"0:a", "1:b"},
+		},
+		{
+			"furigana",
+			`{\k10}漢|かん{\k20}#|じ{\k30}字|じ {\k40}a`,
+			[]karaSyl{
+				{kind: KaraNormal, duration: 100, text: "漢", furi: "かん"},
+				{kind: KaraNormal, start: 100, duration: 200, furi: "じ",
+					furiJoin: true},
+				{kind: KaraNormal, start: 300, duration: 300, text: "字 ",
+					furi: "じ"},
+				{kind: KaraNormal, start: 600, duration: 400, text: "a"},
+			},
+			[]string{"0:漢", "2:字", "2: ", "3:a"},
+		},
+	}
+	for _, tt := range tests {
+		pieces, syls := splitPieces(tt.text)
+		var got []karaSyl
+		for _, s := range syls {
+			got = append(got, *s)
+		}
+		if !reflect.DeepEqual(got, tt.syls) {
+			t.Errorf("%s: syllables\n%+v\nwant\n%+v", tt.name, got, tt.syls)
+		}
+		var texts []string
+		for _, p := range pieces {
+			texts = append(texts, fmt.Sprintf("%d:%s", p.syl, p.text))
+		}
+		if !reflect.DeepEqual(texts, tt.pieces) {
+			t.Errorf("%s: pieces %q, want %q", tt.name, texts, tt.pieces)
+		}
+	}
+}
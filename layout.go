@@ -0,0 +1,468 @@
+package eyecandy
+
+import (
+	"math"
+	"strings"
+
+	"github.com/Alquimista/eyecandy/reader"
+	"github.com/Alquimista/eyecandy/utils"
+)
+
+// Wrap styles, [Script Info] WrapStyle or \q tag
+const (
+	// WrapSmart smart wrapping, the top row is wider
+	WrapSmart int = iota
+	// WrapEndOfLine wrap when the row is full
+	WrapEndOfLine
+	// WrapNone no wrapping, only \N and \n break rows
+	WrapNone
+	// WrapSmartLower smart wrapping, the bottom row is wider
+	WrapSmartLower
+)
+
+// Row a row of text of a Line, split by \N or by the renderer wrapping
+type Row struct {
+	Text    string
+	Width   float64
+	Height  float64
+	Ascent  float64
+	Descent float64
+	X       float64
+	Y       float64
+	Top     float64
+	Middle  float64
+	Bottom  float64
+	Left    float64
+	Center  float64
+	Right   float64
+}
+
+// glyph a char of a Line and its position in the row
+type glyph struct {
+	char    rune
+	syl     int        // index of the syllable, -1 out of the syllables
+	span    *spanStyle // style in effect
+	row     int        // index of the row
+	x       float64    // left, from the left of the row
+	width   float64    // advance, with spacing (and scale)
+	kern    float64    // kerning with the previous char
+	space   bool       // breakable space
+	newline bool       // \N (or \n with WrapNone), not drawn
+	hidden  bool       // space removed at a row break
+	upright bool       // drawn upright in a vertical Line, see upright
+}
+
+// layout the chars of a Line in rows. The rows of a vertical Line are
+// laid out like the horizontal ones and rotated around ox, oy.
+type layout struct {
+	glyphs   []*glyph
+	rows     []*Row
+	vertical bool
+	ox, oy   float64
+}
+
+// parseGlyphs split the pieces of text into chars with the style
+// in effect, the \N, \n and \h escapes are converted
+func parseGlyphs(pieces []piece, style *reader.Style, fonts fontLoader,
+	wrapStyle int) (glyphs []*glyph, err error) {
+	span, err := newSpanStyle(style, fonts)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pieces {
+		span = span.apply(p.tags, style, fonts)
+		text := []rune(p.text)
+		for i := 0; i < len(text); i++ {
+			g := &glyph{char: text[i], syl: p.syl, span: span}
+			if text[i] == '\\' && i+1 < len(text) {
+				switch text[i+1] {
+				case 'N':
+					g.newline = true
+					i++
+				case 'n':
+					// soft break, only with WrapNone, else a space
+					if wrapStyle == WrapNone {
+						g.newline = true
+					} else {
+						g.char, g.space = ' ', true
+					}
+					i++
+				case 'h':
+					g.char = '\u00a0' // non breaking space
+					i++
+				}
+			}
+			g.space = g.space || g.char == ' '
+			g.upright = span.upright(g.char)
+			glyphs = append(glyphs, g)
+		}
+	}
+	return glyphs, nil
+}
+
+// measureGlyphs get the advance of every char, the kerning is used
+// between chars of the same font face
+func measureGlyphs(glyphs []*glyph, kerning bool) {
+	var prev *glyph
+	for _, g := range glyphs {
+		if g.newline {
+			prev = nil
+			continue
+		}
+		span := g.span
+		if g.upright {
+			g.width = span.vertAdvance
+			prev = nil
+			continue
+		}
+		g.width = utils.Measure(span.face, string(drawnChar(g.char)),
+			span.scale, span.spacing, kerning).Width
+		if kerning && prev != nil && prev.span.face == span.face {
+			g.kern = float64(span.face.Kern(
+				drawnChar(prev.char), drawnChar(g.char))) / 64 * span.scale[0] / 100
+		}
+		prev = g
+	}
+}
+
+// drawnChar the char drawn for a char of the text, a space for \h
+func drawnChar(c rune) rune {
+	if c == '\u00a0' {
+		return ' '
+	}
+	return c
+}
+
+// word a sequence of chars between breakable spaces
+type word struct {
+	start, end int     // glyph indexes [start, end)
+	width      float64 // without the spaces
+	space      float64 // width of the spaces before the word
+}
+
+// words split a paragraph in words
+func words(glyphs []*glyph) (ws []word) {
+	space := 0.0
+	start := -1
+	for i, g := range glyphs {
+		if g.space {
+			if start >= 0 {
+				ws = append(ws, word{start, i, 0, space})
+				start, space = -1, 0
+			}
+			space += g.width + g.kern
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		ws = append(ws, word{start, len(glyphs), 0, space})
+	}
+	for i := range ws {
+		w := &ws[i]
+		for j := w.start; j < w.end; j++ {
+			w.width += glyphs[j].width
+			if j > w.start {
+				w.width += glyphs[j].kern
+			}
+		}
+	}
+	return ws
+}
+
+// rowWidth width of the words [start, end)
+func rowWidth(ws []word, start, end int) float64 {
+	width := 0.0
+	for i := start; i < end; i++ {
+		if i > start {
+			width += ws[i].space
+		}
+		width += ws[i].width
+	}
+	return width
+}
+
+// wrapWords split the words in rows (the index of the first word
+// of every row) like the renderers do for each wrap style
+func wrapWords(ws []word, maxWidth float64, wrapStyle int) []int {
+	n := len(ws)
+	if n == 0 || wrapStyle == WrapNone ||
+		rowWidth(ws, 0, n) <= maxWidth {
+		return []int{0}
+	}
+
+	var starts []int
+	if wrapStyle == WrapSmartLower {
+		// fill the rows from the bottom
+		end := n
+		for end > 0 {
+			start := end - 1
+			for start > 0 && rowWidth(ws, start-1, end) <= maxWidth {
+				start--
+			}
+			starts = append([]int{start}, starts...)
+			end = start
+		}
+	} else {
+		start := 0
+		for start < n {
+			end := start + 1
+			for end < n && rowWidth(ws, start, end+1) <= maxWidth {
+				end++
+			}
+			starts = append(starts, start)
+			start = end
+		}
+	}
+	if wrapStyle == WrapEndOfLine {
+		return starts
+	}
+
+	// balance the rows, moving words down (or up) while the difference
+	// between two rows is reduced, the greedy fill keep the top (or
+	// bottom) row wider
+	rowEnd := func(r int) int {
+		if r+1 < len(starts) {
+			return starts[r+1]
+		}
+		return n
+	}
+	for changed, iter := true, 0; changed && iter < n*len(starts); iter++ {
+		changed = false
+		for r := 0; r+1 < len(starts); r++ {
+			upper := rowWidth(ws, starts[r], starts[r+1])
+			lower := rowWidth(ws, starts[r+1], rowEnd(r+1))
+			if wrapStyle == WrapSmart {
+				// move the last word of the upper row down
+				if starts[r+1]-starts[r] < 2 {
+					continue
+				}
+				u := rowWidth(ws, starts[r], starts[r+1]-1)
+				l := rowWidth(ws, starts[r+1]-1, rowEnd(r+1))
+				if l <= maxWidth &&
+					math.Abs(u-l) < math.Abs(upper-lower) {
+					starts[r+1]--
+					changed = true
+				}
+			} else {
+				// move the first word of the lower row up
+				if rowEnd(r+1)-starts[r+1] < 2 {
+					continue
+				}
+				u := rowWidth(ws, starts[r], starts[r+1]+1)
+				l := rowWidth(ws, starts[r+1]+1, rowEnd(r+1))
+				if u <= maxWidth &&
+					math.Abs(u-l) < math.Abs(upper-lower) {
+					starts[r+1]++
+					changed = true
+				}
+			}
+		}
+	}
+	return starts
+}
+
+// breakRows assign a row to every char: the \N breaks and the
+// wrapping of every paragraph. The spaces at the breaks are hidden.
+func breakRows(glyphs []*glyph, maxWidth float64, wrapStyle int) int {
+	row := 0
+	start := 0
+	for i := 0; i <= len(glyphs); i++ {
+		if i < len(glyphs) && !glyphs[i].newline {
+			continue
+		}
+		paragraph := glyphs[start:i]
+		ws := words(paragraph)
+		starts := wrapWords(ws, maxWidth, wrapStyle)
+		r := 0
+		for j, g := range paragraph {
+			for r+1 < len(starts) && j >= ws[starts[r+1]].start {
+				r++
+			}
+			g.row = row + r
+			// a space belong to the row of the previous word
+			if g.space && r > 0 && j < ws[starts[r]].start {
+				g.row--
+			}
+		}
+		row += len(starts)
+		if i < len(glyphs) {
+			// the \N is the end of its row
+			glyphs[i].row = row - 1
+		}
+		start = i + 1
+	}
+	hideSpaces(glyphs)
+	return row
+}
+
+// hideSpaces remove the spaces at the start and end of every row
+func hideSpaces(glyphs []*glyph) {
+	for i, g := range glyphs {
+		if !g.space {
+			continue
+		}
+		leading, trailing := true, true
+		for j := i - 1; j >= 0 && glyphs[j].row == g.row; j-- {
+			if !glyphs[j].space && !glyphs[j].newline {
+				leading = false
+				break
+			}
+		}
+		for j := i + 1; j < len(glyphs) && glyphs[j].row == g.row; j++ {
+			if !glyphs[j].space && !glyphs[j].newline {
+				trailing = false
+				break
+			}
+		}
+		g.hidden = leading || trailing
+	}
+}
+
+// newLayout split the text of a Line in rows and measure them,
+// the height of a row is the one of its biggest font
+func newLayout(pieces []piece, style *reader.Style, fonts fontLoader,
+	kerning bool, wrapStyle int, maxWidth float64) (*layout, error) {
+
+	glyphs, err := parseGlyphs(pieces, style, fonts, wrapStyle)
+	if err != nil {
+		return nil, err
+	}
+	measureGlyphs(glyphs, kerning)
+	n := breakRows(glyphs, maxWidth, wrapStyle)
+
+	l := &layout{glyphs: glyphs}
+	texts := make([]strings.Builder, n)
+	for i := 0; i < n; i++ {
+		l.rows = append(l.rows, &Row{})
+	}
+	for i, g := range glyphs {
+		if g.newline || g.hidden {
+			continue
+		}
+		row := l.rows[g.row]
+		if texts[g.row].Len() > 0 && glyphs[i-1].row == g.row {
+			row.Width += g.kern
+		}
+		g.x = row.Width
+		row.Width += g.width
+		row.Ascent = math.Max(row.Ascent, g.span.ascent)
+		row.Descent = math.Max(row.Descent, g.span.descent)
+		texts[g.row].WriteRune(g.char)
+	}
+	base, err := newSpanStyle(style, fonts)
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range l.rows {
+		row.Text = texts[i].String()
+		if row.Text == "" {
+			// empty rows keep the height of the style
+			row.Ascent, row.Descent = base.ascent, base.descent
+		}
+		row.Height = row.Ascent + row.Descent
+	}
+	return l, nil
+}
+
+// baseline get the offset of the top of a char from the top of its row,
+// the chars of a row share the baseline
+func (l *layout) baseline(g *glyph) float64 {
+	return l.rows[g.row].Ascent - g.span.ascent
+}
+
+// place position the rows in the video, aligned in the box of the margins
+func (l *layout) place(align int, resx, resy, ml, mr, mv float64) {
+	height := 0.0
+	for _, row := range l.rows {
+		height += row.Height
+	}
+
+	top := 0.0
+	switch align {
+	case 7, 8, 9: // top
+		top = mv
+	case 4, 5, 6: // middle
+		top = resy/2.0 - height/2.0
+	case 1, 2, 3: // bottom
+		top = resy - mv - height
+	}
+
+	for _, row := range l.rows {
+		// row x
+		switch align {
+		case 1, 4, 7: // left
+			row.Left = ml
+		case 2, 5, 8: // center
+			row.Left = ml + (resx-ml-mr)/2.0 - row.Width/2.0
+		case 3, 6, 9: // right
+			row.Left = resx - mr - row.Width
+		}
+		row.Center = row.Left + row.Width/2.0
+		row.Right = row.Left + row.Width
+
+		// row y
+		row.Top = top
+		row.Middle = top + row.Height/2.0
+		row.Bottom = top + row.Height
+		top += row.Height
+
+		row.X, row.Y = alignPoint(align, row.Left, row.Center, row.Right,
+			row.Top, row.Middle, row.Bottom)
+	}
+}
+
+// alignPoint get the point of a box used by the alignment (\pos)
+func alignPoint(align int, left, center, right, top, middle,
+	bottom float64) (x, y float64) {
+	switch align {
+	case 1, 4, 7: // left
+		x = left
+	case 2, 5, 8: // center
+		x = center
+	case 3, 6, 9: // right
+		x = right
+	}
+	switch align {
+	case 7, 8, 9: // top
+		y = top
+	case 4, 5, 6: // middle
+		y = middle
+	case 1, 2, 3: // bottom
+		y = bottom
+	}
+	return x, y
+}
+
+// bounds get the box of all the rows
+func (l *layout) bounds() (left, top, right, bottom float64) {
+	for i, row := range l.rows {
+		if i == 0 {
+			left, top, right, bottom = row.Left, row.Top, row.Right, row.Bottom
+			continue
+		}
+		left = math.Min(left, row.Left)
+		right = math.Max(right, row.Right)
+		bottom = row.Bottom
+	}
+	return left, top, right, bottom
+}
+
+// spans get the visible chars of a syllable, the first and last glyph
+// index in every row of the syllable, without the spaces around them
+func (l *layout) spans(syl int) (spans [][2]int) {
+	for i, g := range l.glyphs {
+		if g.syl != syl || g.newline || g.space {
+			continue
+		}
+		n := len(spans)
+		if n > 0 && l.glyphs[spans[n-1][0]].row == g.row {
+			spans[n-1][1] = i
+		} else {
+			spans = append(spans, [2]int{i, i})
+		}
+	}
+	return spans
+}
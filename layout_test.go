@@ -0,0 +1,84 @@
+package eyecandy
+
+import (
+	"testing"
+
+	"github.com/Alquimista/eyecandy/asstime"
+)
+
+// unit a Syl or Char: text, position and times
+type unit struct {
+	text       string
+	left, top  float64
+	start, end asstime.Time
+}
+
+func TestBrokenSyllable(t *testing.T) {
+	// a, b, c, d and g are 25px wide, A 30px, the rows are 60px high
+	tests := []struct {
+		name  string
+		event string
+		syls  []unit
+		chars []unit
+	}{
+		{
+			"\\N",
+			`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\k50}ab\Ncd{\k50}A`,
+			[]unit{
+				{"ab", 0, 0, 1000, 1500},
+				{"cd", 0, 60, 1000, 1500},
+				{"A", 50, 60, 1500, 2000},
+			},
+			[]unit{
+				{"a", 0, 0, 1000, 1125},
+				{"b", 25, 0, 1125, 1250},
+				{"c", 0, 60, 1250, 1375},
+				{"d", 25, 60, 1375, 1500},
+				{"A", 50, 60, 1500, 2000},
+			},
+		},
+		{
+			"wrapping",
+			`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,1140,0,,{\q1\k40}gg gg{\k60}A`,
+			[]unit{
+				{"gg", 0, 0, 1000, 1400},
+				{"gg", 0, 60, 1000, 1400},
+				{"A", 50, 60, 1400, 2000},
+			},
+			[]unit{
+				{"g", 0, 0, 1000, 1100},
+				{"g", 25, 0, 1100, 1200},
+				{"g", 0, 60, 1200, 1300},
+				{"g", 25, 60, 1300, 1400},
+				{"A", 50, 60, 1400, 2000},
+			},
+		},
+	}
+	for _, tt := range tests {
+		line := testScript(t, "", tt.event+"\n").Lines()[0]
+		var syls, chars []unit
+		for _, s := range line.Syls() {
+			syls = append(syls,
+				unit{s.Text, s.Left, s.Top, s.StartTime, s.EndTime})
+		}
+		for _, c := range line.Chars() {
+			chars = append(chars,
+				unit{c.Text, c.Left, c.Top, c.StartTime, c.EndTime})
+		}
+		checkUnits(t, tt.name+": Syls", syls, tt.syls)
+		checkUnits(t, tt.name+": Chars", chars, tt.chars)
+	}
+}
+
+func checkUnits(t *testing.T, name string, got, want []unit) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", name, got, want)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s[%d] = %v, want %v", name, i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package eyecandy
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/Alquimista/eyecandy/random"
+	"github.com/Alquimista/eyecandy/writer"
+)
+
+// Emitter collect the dialogs generated for a Line by ForEachLine
+type Emitter interface {
+	// Add append a Dialog (Syl, Char, Line...) like Script.Add
+	Add(dialog interface{})
+	// Seed get the random seed of the Line
+	Seed() int64
+	// Rand get the random source of the Line, seeded with Seed
+	Rand() *random.Rand
+}
+
+// lineEmitter the Emitter of a Line, the dialogs are kept
+// until the previous lines are done
+type lineEmitter struct {
+	fx      *Script
+	line    *Line
+	dialogs []*writer.Dialog
+}
+
+// Add append a Dialog (Syl, Char, Line...) to the Line
+func (e *lineEmitter) Add(dialog interface{}) {
+	d := e.fx.writerDialog(dialog)
+	if d == nil {
+		fmt.Println("Not admitted object")
+		return
+	}
+	e.dialogs = append(e.dialogs, d)
+}
+
+// Seed get the random seed of the Line
+func (e *lineEmitter) Seed() int64 {
+	return e.line.Seed()
+}
+
+// Rand get the random source of the Line
+func (e *lineEmitter) Rand() *random.Rand {
+	return e.line.Rand()
+}
+
+// ForEachLine call f for every Line of the Script in workers goroutines
+// (the number of CPUs if workers < 1). The dialogs added to the Emitter
+// are appended to the Script in the order of the lines, like in a
+// sequential run, and the random source of every Line is seeded with the
+// Script Seed, its index and its start time, so the output is the same
+// with any number of workers.
+func (fx *Script) ForEachLine(workers int, f func(line *Line, e Emitter)) {
+	lines := fx.Lines()
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	type result struct {
+		i       int
+		dialogs []*writer.Dialog
+	}
+	jobs := make(chan int)
+	results := make(chan result, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				e := &lineEmitter{fx: fx, line: lines[i]}
+				f(lines[i], e)
+				results <- result{i, e.dialogs}
+			}
+		}()
+	}
+	go func() {
+		for i := range lines {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// append the dialogs of a Line as soon as the previous lines are done
+	pending := make(map[int][]*writer.Dialog)
+	next := 0
+	for r := range results {
+		pending[r.i] = r.dialogs
+		for dialogs, ok := pending[next]; ok; dialogs, ok = pending[next] {
+			delete(pending, next)
+			for _, d := range dialogs {
+				fx.addDialog(d)
+			}
+			next++
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package eyecandy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const parallelEvents = `Dialogue: 0,0:00:01.00,0:00:03.00,Default,,0,0,0,,{\k50}AV{\k30}gA {\k40}VVg
+Dialogue: 0,0:00:02.00,0:00:04.00,Default,,0,0,0,,{\k20}A{\k20}g{\k20}V
+Dialogue: 0,0:00:02.00,0:00:04.00,Default,,0,0,0,,{\k20}A{\k20}g{\k20}V
+Dialogue: 0,0:00:05.00,0:00:08.00,Default,,0,0,0,,{\k100}gg{\k100}AA
+Dialogue: 0,0:00:07.00,0:00:09.00,Default,,0,0,0,,AVAV gAgA
+Dialogue: 0,0:00:09.00,0:00:11.00,Default,,0,0,0,,{\k60}V{\k60}A{\k60}g
+`
+
+// parallelFX run an effect with random positions with ForEachLine
+// and get the events of the saved script
+func parallelFX(t *testing.T, workers int) []byte {
+	fx := testScript(t, "", parallelEvents)
+	fx.ForEachLine(workers, func(line *Line, e Emitter) {
+		for _, char := range line.Chars() {
+			c := fx.CopyChar(char)
+			x := char.Left + e.Rand().RandomFloat(-5, 5)
+			y := char.Bottom + float64(e.Rand().RandomInt(-5, 5))
+			c.Tags = fmt.Sprintf(`\pos(%.3f,%.3f)`, x, y)
+			e.Add(c)
+		}
+		l := fx.CopyLine(line)
+		l.Tags = fmt.Sprintf(`\blur%d`, e.Rand().RandomInt(0, 9))
+		e.Add(l)
+	})
+	fn := filepath.Join(t.TempDir(), "test.fx.ass")
+	if err := fx.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b[bytes.Index(b, []byte("[Events]")):]
+}
+
+func TestForEachLineWorkers(t *testing.T) {
+	want := parallelFX(t, 1)
+	if !bytes.Contains(want, []byte(`\pos(`)) {
+		t.Fatalf("no dialogs added:\n%s", want)
+	}
+	for _, workers := range []int{2, 4, 16, 0} {
+		for i := 0; i < 3; i++ {
+			if got := parallelFX(t, workers); !bytes.Equal(got, want) {
+				t.Errorf("workers %d: the output differ from 1 worker:\n"+
+					"%s\nwant:\n%s", workers, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package random provides reproducible random numbers, choices and colors:
+// a Rand seeded with the same number give the same results, like the
+// random helpers of utils and color but without the global source
+package random
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/Alquimista/eyecandy/color"
+)
+
+// Rand a seeded source of random numbers,
+// it isn't safe for concurrent use
+type Rand struct {
+	*rand.Rand
+}
+
+// New create a Rand seeded with seed
+func New(seed int64) *Rand {
+	return &Rand{rand.New(rand.NewSource(seed))}
+}
+
+// RandomFloat random decimal number between min and max
+func (r *Rand) RandomFloat(min, max float64) float64 {
+	return r.Float64()*(max-min) + min
+}
+
+// RandomInt random number between min and max
+func (r *Rand) RandomInt(min, max int) int {
+	return r.Intn(max+1-min) + min
+}
+
+// RandomFloatRange random n numbers between min and max (float)
+func (r *Rand) RandomFloatRange(n int, min, max float64) (nums []float64) {
+	for i := 0; i < n; i++ {
+		nums = append(nums, r.RandomFloat(min, max))
+	}
+	return
+}
+
+// RandomIntRange random n numbers between min and max (integer)
+func (r *Rand) RandomIntRange(n, min, max int) (nums []int) {
+	for i := 0; i < n; i++ {
+		nums = append(nums, r.RandomInt(min, max))
+	}
+	return
+}
+
+// RandomChoiceString select a random choice in a string slice
+func (r *Rand) RandomChoiceString(list []string) string {
+	return list[r.Intn(len(list))]
+}
+
+// RandomChoiceInt select a random choice in a int slice
+func (r *Rand) RandomChoiceInt(list []int) int {
+	return list[r.Intn(len(list))]
+}
+
+// RandomChoiceFloat select a random choice in a float64 slice
+func (r *Rand) RandomChoiceFloat(list []float64) float64 {
+	return list[r.Intn(len(list))]
+}
+
+// RandomColorHSV a color with a random hue (RGoldenHue if f is nil),
+// the saturation s and the value v
+func (r *Rand) RandomColorHSV(s, v int, f func() int) *color.Color {
+	if f == nil {
+		f = r.RGoldenHue
+	}
+	return color.RandomColorHSV(s, v, f)
+}
+
+// RGoldenHue a random hue, spread by the golden ratio
+func (r *Rand) RGoldenHue() int {
+	h := int(math.Mod(360*0.618033988749895*r.Float64(), 360.0) + 0.5)
+	if h > 360 {
+		h -= 360
+	}
+	return h
+}
+
+// RHue a random hue between 1 and 360
+func (r *Rand) RHue() int {
+	return r.RandomInt(1, 360)
+}
@@ -0,0 +1,58 @@
+package random
+
+import (
+	"reflect"
+	"testing"
+)
+
+// draw get a value of every helper of r
+func draw(r *Rand) []interface{} {
+	return []interface{}{
+		r.RandomFloat(-5, 5),
+		r.RandomInt(-5, 5),
+		r.RandomFloatRange(3, 0, 1),
+		r.RandomIntRange(3, 1, 6),
+		r.RandomChoiceString([]string{"a", "b", "c", "d"}),
+		r.RandomChoiceInt([]int{1, 2, 3, 4}),
+		r.RandomChoiceFloat([]float64{0.5, 1.5, 2.5}),
+		r.RandomColorHSV(100, 100, nil).HTML(),
+		r.RGoldenHue(),
+		r.RHue(),
+	}
+}
+
+func TestSameSeed(t *testing.T) {
+	for _, seed := range []int64{0, 1, -7, 1 << 40} {
+		r1, r2 := New(seed), New(seed)
+		for i := 0; i < 20; i++ {
+			a, b := draw(r1), draw(r2)
+			if !reflect.DeepEqual(a, b) {
+				t.Fatalf("seed %d, draw %d: %v != %v", seed, i, a, b)
+			}
+		}
+	}
+	if reflect.DeepEqual(draw(New(1)), draw(New(2))) {
+		t.Error("seeds 1 and 2 give the same values")
+	}
+}
+
+func TestRanges(t *testing.T) {
+	r := New(42)
+	for i := 0; i < 1000; i++ {
+		if f := r.RandomFloat(-5, 5); f < -5 || f >= 5 {
+			t.Fatalf("RandomFloat(-5, 5) = %v", f)
+		}
+		if n := r.RandomInt(-2, 2); n < -2 || n > 2 {
+			t.Fatalf("RandomInt(-2, 2) = %v", n)
+		}
+		if h := r.RGoldenHue(); h < 0 || h > 360 {
+			t.Fatalf("RGoldenHue() = %v", h)
+		}
+		if h := r.RHue(); h < 1 || h > 360 {
+			t.Fatalf("RHue() = %v", h)
+		}
+	}
+	if n := len(r.RandomIntRange(4, 0, 1)); n != 4 {
+		t.Errorf("RandomIntRange(4, ...) get %d numbers", n)
+	}
+}
@@ -0,0 +1,94 @@
+package reader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Attachment a file embedded in the [Fonts] or [Graphics] section.
+type Attachment struct {
+	Name string // e.g. "arial_0.ttf"
+	Data []byte
+}
+
+// uudecode decode the SSA variant of UUencode: every character keep
+// 6 bits (value + 33), without line lengths. A last group of 2 or 3
+// characters encode 1 or 2 bytes.
+func uudecode(s string) ([]byte, error) {
+	data := make([]byte, 0, len(s)*3/4)
+	var group [4]byte
+	n := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 33+63 {
+			return nil, fmt.Errorf("invalid character %q", c)
+		}
+		group[n] = c - 33
+		n++
+		if n == 4 {
+			data = append(data,
+				group[0]<<2|group[1]>>4,
+				group[1]<<4|group[2]>>2,
+				group[2]<<6|group[3])
+			n = 0
+		}
+	}
+	switch n {
+	case 1:
+		return nil, fmt.Errorf("truncated data")
+	case 2:
+		data = append(data, group[0]<<2|group[1]>>4)
+	case 3:
+		data = append(data,
+			group[0]<<2|group[1]>>4,
+			group[1]<<4|group[2]>>2)
+	}
+	return data, nil
+}
+
+// attachmentDecoder collect the lines of the attachments of a section
+type attachmentDecoder struct {
+	attachments []*Attachment
+	name        string
+	line        int // line number of the "fontname:" line
+	data        strings.Builder
+	orphan      bool // data without fontname, already reported
+}
+
+// add read a line of the section
+func (d *attachmentDecoder) add(line string, lineN int) error {
+	lower := strings.ToLower(line)
+	if strings.HasPrefix(lower, "fontname:") ||
+		strings.HasPrefix(lower, "filename:") {
+		err := d.flush()
+		d.name = strings.TrimSpace(line[len("fontname:"):])
+		d.line = lineN
+		d.orphan = false
+		return err
+	}
+	if d.name == "" {
+		if d.orphan {
+			return nil
+		}
+		d.orphan = true
+		return &fieldError{"Attachment", fmt.Errorf("data without fontname")}
+	}
+	d.data.WriteString(line)
+	return nil
+}
+
+// flush decode the current attachment, a malformed one is dropped
+func (d *attachmentDecoder) flush() error {
+	if d.name == "" {
+		return nil
+	}
+	name, line := d.name, d.line
+	data, err := uudecode(d.data.String())
+	d.name = ""
+	d.data.Reset()
+	if err != nil {
+		return &ParseError{Line: line, Field: name, Err: err}
+	}
+	d.attachments = append(d.attachments, &Attachment{name, data})
+	return nil
+}
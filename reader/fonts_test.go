@@ -0,0 +1,79 @@
+package reader
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUudecode(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+		err  bool
+	}{
+		{"", "", false},
+		{"97*D", "abc", false},
+		{"97*D97", "abca", false},
+		{"97*D97)", "abcab", false},
+		{"97*D9", "", true},
+		{"97 D", "", true},
+		{"97~D", "", true},
+	}
+	for _, tt := range tests {
+		got, err := uudecode(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("uudecode(%q) error = %v, want error %v", tt.s, err, tt.err)
+			continue
+		}
+		if err == nil && string(got) != tt.want {
+			t.Errorf("uudecode(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseFonts(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	src := testHeader + testStyle + "\n[Fonts]\n" +
+		"97*D\n" + "97*D\n" + // data without fontname, reported once
+		"fontname: bad_0.ttf\n97~D\n" +
+		"fontname: good_0.ttf\n97*D\n97\n" +
+		"fontname: last_0.ttf\n97*D9\n" +
+		testEvents +
+		"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Hi\n"
+	s, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Fonts) != 1 || s.Fonts[0].Name != "good_0.ttf" ||
+		string(s.Fonts[0].Data) != "abca" {
+		t.Errorf("Fonts = %+v, want only good_0.ttf", s.Fonts)
+	}
+	if len(s.Dialog) != 1 {
+		t.Errorf("got %d dialogs after [Fonts], want 1", len(s.Dialog))
+	}
+	// the section is kept verbatim
+	if len(s.Sections) != 1 || len(s.Sections[0].Lines) != 9 {
+		t.Errorf("Sections = %+v", s.Sections)
+	}
+	lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+	want := []string{
+		"reader: line 11: Attachment: data without fontname",
+		"reader: line 13: bad_0.ttf: invalid character",
+		"reader: line 18: last_0.ttf: truncated data",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("logged %q, want %d lines", logged.String(), len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(lines[i], w) ||
+			!strings.HasSuffix(lines[i], "skipping the attachment") {
+			t.Errorf("log line %d = %q, want %q", i, lines[i], w)
+		}
+	}
+}
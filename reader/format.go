@@ -0,0 +1,108 @@
+package reader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Default Format lines, used when a section doesn't declare one.
+const (
+	assStyleFormat = "Name, Fontname, Fontsize, PrimaryColour, " +
+		"SecondaryColour, OutlineColour, BackColour, Bold, Italic, " +
+		"Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, " +
+		"Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding"
+	ssaStyleFormat = "Name, Fontname, Fontsize, PrimaryColour, " +
+		"SecondaryColour, TertiaryColour, BackColour, Bold, Italic, " +
+		"BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, " +
+		"AlphaLevel, Encoding"
+	assEventFormat = "Layer, Start, End, Style, Name, MarginL, MarginR, " +
+		"MarginV, Effect, Text"
+	ssaEventFormat = "Marked, Start, End, Style, Name, MarginL, MarginR, " +
+		"MarginV, Effect, Text"
+)
+
+// Section names
+const (
+	sectionScriptInfo = "script info"
+	sectionGarbage    = "aegisub project garbage"
+	sectionASSStyles  = "v4+ styles"
+	sectionSSAStyles  = "v4 styles"
+	sectionEvents     = "events"
+	sectionFonts      = "fonts"
+)
+
+// maxLineSize the longest line accepted by the reader
+const maxLineSize = 16 * 1024 * 1024
+
+// knownSection get if the reader interpret the lines of a section,
+// the others are kept verbatim.
+func knownSection(section string) bool {
+	switch section {
+	case sectionScriptInfo, sectionGarbage,
+		sectionASSStyles, sectionSSAStyles, sectionEvents:
+		return true
+	}
+	return false
+}
+
+// format map the columns of a Style or Dialogue line,
+// declared by the Format line of its section.
+type format struct {
+	names  []string // as written in the Format line
+	keys   []string // lowercase names
+	legacy bool     // SSA v4.00 layout
+}
+
+// newFormat parse the value of a Format line.
+func newFormat(value string, legacy bool) *format {
+	f := &format{legacy: legacy}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		f.names = append(f.names, name)
+		f.keys = append(f.keys, strings.ToLower(name))
+	}
+	return f
+}
+
+// defaultStyleFormat get the Style Format when the script doesn't have it.
+func defaultStyleFormat(legacy bool) *format {
+	if legacy {
+		return newFormat(ssaStyleFormat, true)
+	}
+	return newFormat(assStyleFormat, false)
+}
+
+// defaultEventFormat get the Dialogue Format when the script doesn't have it.
+func defaultEventFormat(legacy bool) *format {
+	if legacy {
+		return newFormat(ssaEventFormat, true)
+	}
+	return newFormat(assEventFormat, false)
+}
+
+// split split the value of a line in the fields of the Format,
+// the last field (Text) can contain commas.
+func (f *format) split(kind, value string) ([]string, error) {
+	n := len(f.keys)
+	fields := strings.SplitN(value, ",", n)
+	if len(fields) != n {
+		return nil, fmt.Errorf("%s has %d fields, expected %d",
+			kind, len(fields), n)
+	}
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(field)
+	}
+	return fields, nil
+}
+
+// alignFromSSA convert a legacy SSA alignment to the numpad layout of ASS.
+// SSA: 1-3 bottom, 5-7 top, 9-11 middle.
+func alignFromSSA(align int) int {
+	switch {
+	case align >= 5 && align <= 7:
+		return align + 2
+	case align >= 9 && align <= 11:
+		return align - 5
+	}
+	return align
+}
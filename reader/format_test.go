@@ -0,0 +1,106 @@
+package reader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseFormat(t *testing.T) {
+	// reordered and omitted columns, the Text is always the last one
+	src := `[Script Info]
+ScriptType: v4.00+
+
+[V4+ Styles]
+Format: Name, Alignment, Fontsize, Fontname
+Style: Title, 7, 60, Verdana
+
+[Events]
+Format: Start, End, Text
+Dialogue: 0:00:01.00,0:00:02.00,Hi, there
+`
+	s, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sty := s.Style["Title"]
+	if sty == nil {
+		t.Fatal("the Title style wasn't read")
+	}
+	def := NewStyle("Title")
+	if sty.FontName != "Verdana" || sty.FontSize != 60 || sty.Alignment != 7 ||
+		sty.Margin != def.Margin || sty.Bord != def.Bord {
+		t.Errorf("Style = %+v", sty)
+	}
+	if len(s.Dialog) != 1 {
+		t.Fatalf("got %d dialogs, want 1", len(s.Dialog))
+	}
+	d := s.Dialog[0]
+	if d.StartTime != 1000 || d.EndTime != 2000 || d.Text != "Hi, there" ||
+		d.StyleName != "Default" || d.Layer != 0 {
+		t.Errorf("Dialogue = %+v", d)
+	}
+}
+
+func TestParseSSA(t *testing.T) {
+	styles := []struct {
+		name   string
+		format string // without the Format line
+	}{
+		{"format", "Format: Name, Fontname, Fontsize, PrimaryColour, " +
+			"SecondaryColour, TertiaryColour, BackColour, Bold, Italic, " +
+			"BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, " +
+			"MarginV, AlphaLevel, Encoding\n"},
+		{"default format", ""},
+	}
+	for _, st := range styles {
+		src := "[Script Info]\nScriptType: v4.00\n\n[V4 Styles]\n" +
+			st.format +
+			"Style: Default,Arial,30,65535,255,&H00FF0000&,0,-1,0,1,2,1,6,10,20,30,0,1\n" +
+			"Style: Middle,Arial,30,65535,255,0,0,0,0,1,2,1,9,10,20,30,0,1\n" +
+			"Style: Bottom,Arial,30,65535,255,0,0,0,0,1,2,1,3,10,20,30,0,1\n\n" +
+			"[Events]\n" +
+			"Dialogue: Marked=0,0:00:01.00,0:00:02.00,Default,,0,0,0,,Hi\n"
+		s, err := Parse(strings.NewReader(src))
+		if err != nil {
+			t.Errorf("%s: %v", st.name, err)
+			continue
+		}
+		sty := s.Style["Default"]
+		if sty == nil || !sty.Bold || sty.Margin != [3]int{10, 20, 30} {
+			t.Errorf("%s: Style = %+v", st.name, sty)
+			continue
+		}
+		// decimal BGR colors and the TertiaryColour as the border color
+		colors := [][4]uint8{{255, 255, 0, 0}, {255, 0, 0, 0}, {0, 0, 255, 0}}
+		for i, want := range colors {
+			r, g, b, a := sty.Color[i].RGBA()
+			if got := [4]uint8{r, g, b, a}; got != want {
+				t.Errorf("%s: Color[%d] = %v, want %v", st.name, i, got, want)
+			}
+		}
+		for name, want := range map[string]int{
+			"Default": 8, "Middle": 4, "Bottom": 3} {
+			if got := s.Style[name].Alignment; got != want {
+				t.Errorf("%s: %s Alignment = %d, want %d",
+					st.name, name, got, want)
+			}
+		}
+		if len(s.Dialog) != 1 || s.Dialog[0].Text != "Hi" ||
+			s.Dialog[0].EndTime != 2000 {
+			t.Errorf("%s: Dialog = %+v", st.name, s.Dialog)
+		}
+	}
+}
+
+func TestAlignFromSSA(t *testing.T) {
+	tests := []struct{ ssa, ass int }{
+		{1, 1}, {2, 2}, {3, 3},
+		{5, 7}, {6, 8}, {7, 9},
+		{9, 4}, {10, 5}, {11, 6},
+	}
+	for _, tt := range tests {
+		if got := alignFromSSA(tt.ssa); got != tt.ass {
+			t.Errorf("alignFromSSA(%d) = %d, want %d", tt.ssa, got, tt.ass)
+		}
+	}
+}
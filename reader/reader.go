@@ -4,10 +4,13 @@ package reader
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"log"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/Alquimista/eyecandy/asstime"
 	"github.com/Alquimista/eyecandy/color"
 	"github.com/Alquimista/eyecandy/utils"
 )
@@ -18,15 +21,17 @@ const alignTopCenter int = 8
 // dialog Represent the subtitle's lines.
 type dialog struct {
 	Layer     int
-	StartTime string
-	EndTime   string
+	StartTime asstime.Time
+	EndTime   asstime.Time
 	StyleName string
 	Style     *Style
 	Actor     string
+	Margin    [3]int // L, R, V (0 use the Style margin)
 	Effect    string
 	Text      string
 	Tags      string
 	Comment   bool
+	Line      int // line number in the script, from 1
 }
 
 // DialogCollection collection of Dialog's in a SSA/ASS Script
@@ -94,12 +99,31 @@ func NewStyle(name string) *Style {
 	}
 }
 
+// Field a "Key: Value" line of the [Script Info]
+// or [Aegisub Project Garbage] sections.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Section a section kept verbatim ([Fonts], [Graphics],
+// [Aegisub Extradata] or unknown sections).
+type Section struct {
+	Name  string // without brackets
+	Lines []string
+}
+
 // Script SSA/ASS Subtitle Script.
 type Script struct {
 	Dialog             DialogCollection
 	Style              map[string]*Style
 	StyleUsed          map[string]*Style
-	Resolution         [2]int // WIDTH, HEIGHT
+	Comments           []string // [Script Info] comments, without "; "
+	Info               []Field  // [Script Info] keys not read into fields
+	Garbage            []Field  // [Aegisub Project Garbage] keys not read
+	Sections           []*Section
+	Fonts              []*Attachment // decoded from the [Fonts] section
+	Resolution         [2]int        // WIDTH, HEIGHT
 	VideoPath          string
 	VideoZoom          float64
 	VideoPosition      int
@@ -112,90 +136,351 @@ type Script struct {
 	Audio              string
 }
 
-// parseStyle parse an SSA/ASS Subtitle Dialog.
-func parseDialog(key, value string) *dialog {
-	// d := strings.SplitN(value, ",", 10)
-	d := regexp.MustCompile(",").Split(value, 10)
-	return &dialog{
-		Layer:     utils.Str2int(d[0]),
-		StartTime: d[1],
-		EndTime:   d[2],
-		StyleName: d[3],
-		Actor:     d[4],
-		Effect:    d[8],
-		Text:      strings.TrimSpace(d[9]),
-		Comment:   key == "comment",
+// ParseError describe a malformed line in an SSA/ASS Subtitle Script.
+type ParseError struct {
+	Filename string
+	Line     int    // line number, starting at 1
+	Section  string // e.g. "V4+ Styles"
+	Field    string // empty when the whole line is malformed
+	Err      error
+}
+
+func (e *ParseError) Error() string {
+	msg := "reader: "
+	if e.Filename != "" {
+		msg += e.Filename + ": "
+	}
+	msg += fmt.Sprintf("line %d: ", e.Line)
+	if e.Field != "" {
+		msg += e.Field + ": "
+	}
+	return msg + e.Err.Error()
+}
+
+// Unwrap return the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// newParseError create a ParseError for an error of a line parser
+func newParseError(err error, line int, section, key string) *ParseError {
+	if perr, ok := err.(*ParseError); ok {
+		if perr.Section == "" {
+			perr.Section = section
+		}
+		return perr
+	}
+	perr := &ParseError{Line: line, Section: section, Err: err}
+	if ferr, ok := err.(*fieldError); ok {
+		perr.Field, perr.Err = ferr.field, ferr.err
+	} else if nerr, ok := err.(*strconv.NumError); ok {
+		perr.Field = key
+		perr.Err = fmt.Errorf("invalid number %q", nerr.Num)
+	}
+	return perr
+}
+
+// fieldError is returned by the line parsers, the caller fill the position.
+type fieldError struct {
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return e.field + ": " + e.err.Error()
+}
+
+// fieldParser parse numeric fields, keeping the first error.
+type fieldParser struct {
+	err error
+}
+
+func (p *fieldParser) int(name, s string) int {
+	if p.err != nil {
+		return 0
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		// Some tools write integer fields as decimals (e.g. "40.0")
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil {
+			p.err = &fieldError{name, fmt.Errorf("invalid number %q", s)}
+			return 0
+		}
+		i = int(f)
+	}
+	return i
+}
+
+func (p *fieldParser) float(name, s string) float64 {
+	if p.err != nil {
+		return 0
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		p.err = &fieldError{name, fmt.Errorf("invalid number %q", s)}
+		return 0
+	}
+	return f
+}
+
+func (p *fieldParser) time(name, s string) asstime.Time {
+	if p.err != nil {
+		return 0
+	}
+	t, err := asstime.Parse(s)
+	if err != nil {
+		p.err = &fieldError{name, fmt.Errorf("invalid time %q", s)}
+		return 0
+	}
+	return t
+}
+
+func (p *fieldParser) color(name, s string) *color.Color {
+	if p.err != nil {
+		return nil
 	}
+	c, err := color.ParseSSA(s)
+	if err == nil {
+		return c
+	}
+	// SSA v4.00 scripts can store colors as decimal BGR numbers
+	n, nerr := strconv.ParseInt(s, 10, 64)
+	if nerr != nil {
+		p.err = &fieldError{name, fmt.Errorf("invalid color %q", s)}
+		return nil
+	}
+	return color.NewFromRGBA(
+		uint8(n), uint8(n>>8), uint8(n>>16), uint8(n>>24))
+}
+
+// parseDialog parse an SSA/ASS Subtitle Dialog.
+func parseDialog(f *format, key, value string) (*dialog, error) {
+	fields, err := f.split("Dialogue", value)
+	if err != nil {
+		return nil, err
+	}
+	p := &fieldParser{}
+	dlg := &dialog{Comment: key == "comment"}
+	for i, v := range fields {
+		name := f.names[i]
+		switch f.keys[i] {
+		case "layer":
+			dlg.Layer = p.int(name, v)
+		case "start":
+			dlg.StartTime = p.time(name, v)
+		case "end":
+			dlg.EndTime = p.time(name, v)
+		case "style":
+			dlg.StyleName = v
+		case "name", "actor":
+			dlg.Actor = v
+		case "marginl":
+			dlg.Margin[0] = p.int(name, v)
+		case "marginr":
+			dlg.Margin[1] = p.int(name, v)
+		case "marginv":
+			dlg.Margin[2] = p.int(name, v)
+		case "effect":
+			dlg.Effect = v
+		case "text":
+			dlg.Text = v
+		}
+	}
+	if dlg.StyleName == "" {
+		dlg.StyleName = "Default"
+	}
+	return dlg, p.err
 }
 
 // parseStyle parse an SSA/ASS Subtitle Style.
-func parseStyle(value string) *Style {
-	// sty := strings.SplitN(value, ",", 23)
-	sty := regexp.MustCompile(",").Split(value, 23)
-	return &Style{
-		Name:     sty[0],
-		FontName: sty[1],
-		FontSize: utils.Str2int(sty[2]),
-		Color: [4]*color.Color{
-			color.NewFromSSA(sty[3]),  // Primary
-			color.NewFromSSA(sty[4]),  // Secondary
-			color.NewFromSSA(sty[5]),  // Bord
-			color.NewFromSSA(sty[6])}, // Shadow
-		Bold:      utils.Str2bool(sty[7]),
-		Italic:    utils.Str2bool(sty[8]),
-		Underline: utils.Str2bool(sty[9]),
-		StrikeOut: utils.Str2bool(sty[10]),
-		Scale: [2]float64{
-			utils.Str2float(sty[11]), // X
-			utils.Str2float(sty[12]), // Y
-		},
-		Spacing:   utils.Str2float(sty[13]),
-		Angle:     utils.Str2int(sty[14]),
-		OpaqueBox: utils.Obox2bool(sty[15]),
-		Bord:      utils.Str2float(sty[16]),
-		Shadow:    utils.Str2float(sty[17]),
-		Alignment: utils.Str2int(sty[18]),
-		Margin: [3]int{
-			utils.Str2int(sty[19]), // L
-			utils.Str2int(sty[20]), // R
-			utils.Str2int(sty[21]), // V
-		},
+// The columns missing in the Format take the values of NewStyle.
+func parseStyle(f *format, value string) (*Style, error) {
+	fields, err := f.split("Style", value)
+	if err != nil {
+		return nil, err
 	}
+	p := &fieldParser{}
+	sty := NewStyle("Default")
+	for i, v := range fields {
+		name := f.names[i]
+		switch f.keys[i] {
+		case "name":
+			sty.Name = v
+		case "fontname":
+			sty.FontName = v
+		case "fontsize":
+			sty.FontSize = p.int(name, v)
+		case "primarycolour":
+			sty.Color[0] = p.color(name, v)
+		case "secondarycolour":
+			sty.Color[1] = p.color(name, v)
+		case "outlinecolour", "tertiarycolour":
+			sty.Color[2] = p.color(name, v)
+		case "backcolour":
+			sty.Color[3] = p.color(name, v)
+		case "bold":
+			sty.Bold = utils.Str2bool(v)
+		case "italic":
+			sty.Italic = utils.Str2bool(v)
+		case "underline":
+			sty.Underline = utils.Str2bool(v)
+		case "strikeout":
+			sty.StrikeOut = utils.Str2bool(v)
+		case "scalex":
+			sty.Scale[0] = p.float(name, v)
+		case "scaley":
+			sty.Scale[1] = p.float(name, v)
+		case "spacing":
+			sty.Spacing = p.float(name, v)
+		case "angle":
+			sty.Angle = p.int(name, v)
+		case "borderstyle":
+			sty.OpaqueBox = utils.Obox2bool(v)
+		case "outline":
+			sty.Bord = p.float(name, v)
+		case "shadow":
+			sty.Shadow = p.float(name, v)
+		case "alignment":
+			sty.Alignment = p.int(name, v)
+			if f.legacy {
+				sty.Alignment = alignFromSSA(sty.Alignment)
+			}
+		case "marginl":
+			sty.Margin[0] = p.int(name, v)
+		case "marginr":
+			sty.Margin[1] = p.int(name, v)
+		case "marginv":
+			sty.Margin[2] = p.int(name, v)
+		case "encoding":
+			sty.Encoding = p.int(name, v)
+		}
+	}
+	return sty, p.err
 }
 
 // parseAR parse an SSA/ASS Aspect Ratio.
-func parseAR(value string) float64 {
+func parseAR(value string) (float64, error) {
 	ar := strings.Replace(value, "c", "", -1)
 	numden := strings.SplitN(ar, ":", 2)
 	if len(numden) == 2 {
-		num, den := utils.Str2float(numden[0]),
-			utils.Str2float(numden[1])
-		return num / den
+		num, err := strconv.ParseFloat(numden[0], 64)
+		if err != nil {
+			return 0, err
+		}
+		den, err := strconv.ParseFloat(numden[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		return num / den, nil
 	}
-	return utils.Str2float(ar)
+	return strconv.ParseFloat(ar, 64)
 }
 
 // Read parse and read an SSA/ASS Subtitle Script.
+//
+// Deprecated: Read panics on malformed scripts, use ReadFile.
 func Read(fn string) *Script {
+	s, err := ReadFile(fn)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
 
-	s := &Script{}
+// ReadFile parse and read an SSA/ASS Subtitle Script file.
+func ReadFile(fn string) (*Script, error) {
 	f, err := os.Open(fn)
 	if err != nil {
-		panic(fmt.Errorf("reader: failed opening subtitle file: %s", err))
+		return nil, fmt.Errorf("reader: failed opening subtitle file: %s", err)
 	}
 	defer f.Close()
 
+	s, err := Parse(f)
+	if err != nil {
+		if perr, ok := err.(*ParseError); ok {
+			perr.Filename = fn
+		}
+		return nil, err
+	}
+	s.MetaFilename = fn
+	return s, nil
+}
+
+// skipAttachment report a malformed attachment of the [Fonts] section,
+// a font is not needed to read the script
+func skipAttachment(err error) {
+	log.Printf("%s, skipping the attachment", err)
+}
+
+// Parse parse an SSA/ASS Subtitle Script.
+// Malformed lines are reported as a *ParseError,
+// the malformed attachments are logged and skipped.
+func Parse(r io.Reader) (*Script, error) {
+
+	s := &Script{}
 	s.Style = make(map[string]*Style)
 	s.StyleUsed = make(map[string]*Style)
 	var playresx, playresy int
 	var videozoom float64
 
-	scanner := bufio.NewScanner(f)
+	section, sectionName := "", ""
+	legacy := false // SSA v4.00 script
+	formats := make(map[string]*format)
+	var verbatim *Section
+	fonts := &attachmentDecoder{}
+	fontsName := ""
+	lineN := 0
+	scanner := bufio.NewScanner(r)
+	// Drawings and extradata can be longer than the default 64KB
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, ";") ||
-			strings.HasPrefix(line, "!:") ||
-			strings.HasPrefix(line, "Format:") {
+		lineN++
+		line := scanner.Text()
+		if lineN == 1 {
+			line = strings.TrimPrefix(line, "\uFEFF") // BOM
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			sectionName = line[1 : len(line)-1]
+			section = strings.ToLower(sectionName)
+			if section == sectionSSAStyles {
+				legacy = true
+			}
+			if err := fonts.flush(); err != nil {
+				skipAttachment(newParseError(err, lineN, fontsName, ""))
+			}
+			if section == sectionFonts {
+				fontsName = sectionName
+			}
+			verbatim = nil
+			if !knownSection(section) {
+				verbatim = &Section{Name: sectionName}
+				s.Sections = append(s.Sections, verbatim)
+			}
+			continue
+		}
+		if verbatim != nil {
+			// [Fonts] and [Graphics] data can start with ";" or "!"
+			verbatim.Lines = append(verbatim.Lines, line)
+			if section == sectionFonts {
+				if err := fonts.add(line, lineN); err != nil {
+					skipAttachment(newParseError(err, lineN, sectionName, ""))
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ";") {
+			if section == sectionScriptInfo {
+				comment := strings.TrimSpace(line[1:])
+				s.Comments = append(s.Comments, comment)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "!:") {
 			continue
 		}
 
@@ -209,34 +494,56 @@ func Read(fn string) *Script {
 		key = strings.Replace(key, " ", "_", -1)
 		value = strings.TrimSpace(value)
 
+		var err error
 		switch key {
+		case "format":
+			formats[section] = newFormat(value, section == sectionSSAStyles)
 		case "dialogue", "comment":
-			s.Dialog = append(s.Dialog, parseDialog(key, value))
+			f, ok := formats[section]
+			if !ok {
+				f = defaultEventFormat(legacy)
+			}
+			var d *dialog
+			if d, err = parseDialog(f, key, value); err == nil {
+				d.Line = lineN
+				s.Dialog = append(s.Dialog, d)
+			}
 		case "style":
-			style := parseStyle(value)
-			s.Style[style.Name] = style
+			f, ok := formats[section]
+			if !ok {
+				f = defaultStyleFormat(section == sectionSSAStyles ||
+					(section != sectionASSStyles && legacy))
+			}
+			var style *Style
+			if style, err = parseStyle(f, value); err == nil {
+				s.Style[style.Name] = style
+			}
+		case "scripttype":
+			// The writer always write v4.00+ scripts
+			legacy = strings.ToLower(value) == "v4.00"
 		case "playresx":
-			playresx = utils.Str2int(value)
+			playresx, err = strconv.Atoi(value)
 		case "playresy":
-			playresy = utils.Str2int(value)
+			playresy, err = strconv.Atoi(value)
 		case "audio_uri", "audio_file":
 			s.Audio = value
 		case "video_file":
 			s.VideoPath = value
 		case "video_zoom_percent":
-			videozoom = utils.Str2float(value)
+			videozoom, err = strconv.ParseFloat(value, 64)
 		case "video_zoom":
 			// Use "video_zoom_percent" key if present
 			// else use "video_zoom" key
 			if videozoom == 0.0 {
 				zoom := strings.Replace(value, "%", "", -1)
-				videozoom = utils.Str2float(zoom) / 100.0
+				videozoom, err = strconv.ParseFloat(zoom, 64)
+				videozoom /= 100.0
 			}
 		case "video_aspect_ratio", "video_ar_value",
 			"aegisub_video_aspect_ratio":
-			s.VideoAR = parseAR(value)
+			s.VideoAR, err = parseAR(value)
 		case "video_position":
-			s.VideoPosition = utils.Str2int(value)
+			s.VideoPosition, err = strconv.Atoi(value)
 		case "title":
 			s.MetaTitle = value
 		case "original_script":
@@ -246,25 +553,45 @@ func Read(fn string) *Script {
 		case "timing":
 			s.MetaTiming = value
 		default:
+			f := Field{strings.TrimSpace(keyvalue[0]), value}
+			switch section {
+			case sectionScriptInfo:
+				s.Info = append(s.Info, f)
+			case sectionGarbage:
+				s.Garbage = append(s.Garbage, f)
+			}
 			continue
 		}
+		if err != nil {
+			return nil, newParseError(err, lineN, sectionName, keyvalue[0])
+		}
 	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reader: failed reading subtitle: %s", err)
+	}
+	if err := fonts.flush(); err != nil {
+		skipAttachment(newParseError(err, lineN, fontsName, ""))
+	}
+	s.Fonts = fonts.attachments
 
 	s.Resolution = [2]int{playresx, playresy}
 	s.VideoZoom = videozoom
-	s.MetaFilename = fn
 
 	// Get only the styles used in dialogs
 	for _, d := range s.Dialog {
 		if !d.Comment {
 			sty, ok := s.Style[d.StyleName]
 			if !ok {
-				sty = s.Style["Default"]
+				sty, ok = s.Style["Default"]
+			}
+			if !ok {
+				// Renderers fallback to the default style
+				sty = NewStyle("Default")
 			}
 			d.Style = sty
 			s.StyleUsed[d.StyleName] = sty
 		}
 	}
 
-	return s
+	return s, nil
 }
@@ -0,0 +1,160 @@
+package reader
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 1280
+PlayResY: 720
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+`
+
+const testStyle = "Style: Default,Arial,40,&H00FFFFFF,&H000000FF,&H00000000," +
+	"&H00000000,0,0,0,0,100,100,0,0,1,2,2,2,10,20,30,1\n"
+
+const testEvents = `
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+func TestParse(t *testing.T) {
+	src := testHeader + testStyle + testEvents +
+		"Dialogue: 1,0:00:01.00,0:00:02.50,Default,Actor,0,0,0,fx,Hello, world\n" +
+		"Comment: 0,0:00:03.00,0:00:04.00,Default,,0,0,0,template syl,{\\blur2}\n"
+	s, err := Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Resolution != [2]int{1280, 720} {
+		t.Errorf("Resolution = %v, want [1280 720]", s.Resolution)
+	}
+	if len(s.Dialog) != 2 {
+		t.Fatalf("got %d dialogs, want 2", len(s.Dialog))
+	}
+	d := s.Dialog[0]
+	if d.Layer != 1 || d.StartTime != 1000 || d.EndTime != 2500 ||
+		d.Actor != "Actor" || d.Effect != "fx" || d.Text != "Hello, world" ||
+		d.Comment {
+		t.Errorf("Dialogue = %+v", d)
+	}
+	if c := s.Dialog[1]; !c.Comment || c.Effect != "template syl" {
+		t.Errorf("Comment = %+v", c)
+	}
+	sty := s.Style["Default"]
+	if sty == nil || sty.FontSize != 40 || sty.Alignment != 2 ||
+		sty.Margin != [3]int{10, 20, 30} {
+		t.Errorf("Style = %+v", sty)
+	}
+	if _, ok := s.StyleUsed["Default"]; !ok {
+		t.Error("the style of the dialogs isn't in StyleUsed")
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		line    int
+		section string
+		field   string
+		msg     string
+	}{
+		{
+			"style without fields",
+			testHeader + "Style: Default,Arial,40,&H00FFFFFF,&H000000FF," +
+				"&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,2,2\n",
+			8, "V4+ Styles", "",
+			"reader: line 8: Style has 19 fields, expected 23",
+		},
+		{
+			"style number",
+			testHeader + "Style: Default,Arial,big,&H00FFFFFF,&H000000FF," +
+				"&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,2,2,10,20,30,1\n",
+			8, "V4+ Styles", "Fontsize",
+			`reader: line 8: Fontsize: invalid number "big"`,
+		},
+		{
+			"style color",
+			testHeader + "Style: Default,Arial,40,&HXX,&H000000FF," +
+				"&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,2,2,2,10,20,30,1\n",
+			8, "V4+ Styles", "PrimaryColour",
+			`reader: line 8: PrimaryColour: invalid color "&HXX"`,
+		},
+		{
+			"dialogue time",
+			testHeader + testStyle + testEvents +
+				"Dialogue: 0,0:00:01.00,later,Default,,0,0,0,,Hi\n",
+			12, "Events", "End",
+			`reader: line 12: End: invalid time "later"`,
+		},
+		{
+			"dialogue without fields",
+			testHeader + testStyle + testEvents + "Dialogue: 0,0:00:01.00\n",
+			12, "Events", "",
+			"reader: line 12: Dialogue has 2 fields, expected 10",
+		},
+		{
+			"dialogue margin",
+			testHeader + testStyle + testEvents +
+				"Dialogue: 0,0:00:01.00,0:00:02.00,Default,,left,0,0,,Hi\n",
+			12, "Events", "MarginL",
+			`reader: line 12: MarginL: invalid number "left"`,
+		},
+		{
+			"script info",
+			"[Script Info]\nPlayResX: 1280\nPlayResY: wide\n",
+			3, "Script Info", "PlayResY",
+			`reader: line 3: PlayResY: invalid number "wide"`,
+		},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.src))
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: got error %v, want a *ParseError", tt.name, err)
+			continue
+		}
+		if perr.Line != tt.line || perr.Section != tt.section ||
+			perr.Field != tt.field {
+			t.Errorf("%s: got line %d, section %q, field %q, "+
+				"want line %d, section %q, field %q", tt.name,
+				perr.Line, perr.Section, perr.Field,
+				tt.line, tt.section, tt.field)
+		}
+		if perr.Error() != tt.msg {
+			t.Errorf("%s: got %q, want %q", tt.name, perr.Error(), tt.msg)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := ReadFile(filepath.Join(dir, "missing.ass")); err == nil {
+		t.Error("ReadFile of a missing file didn't fail")
+	}
+
+	fn := filepath.Join(dir, "bad.ass")
+	src := "\uFEFF" + testHeader + "Style: Default\n"
+	if err := ioutil.WriteFile(fn, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadFile(fn)
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Filename != fn || perr.Line != 8 {
+		t.Errorf("ReadFile(%q) = %v, want a *ParseError of line 8", fn, err)
+	}
+}
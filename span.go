@@ -0,0 +1,196 @@
+package eyecandy
+
+import (
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+
+	"github.com/Alquimista/eyecandy/asstags"
+	"github.com/Alquimista/eyecandy/fontcache"
+	"github.com/Alquimista/eyecandy/reader"
+	"github.com/Alquimista/eyecandy/utils"
+)
+
+// piece a text of a Line, with the override tags before it
+// and the index of its syllable
+type piece struct {
+	tags []*asstags.Tag
+	text string
+	syl  int
+}
+
+// fontLoader load the font faces and styles used by the override tags
+type fontLoader interface {
+	face(name string, size float64, weight int, italic bool) (font.Face, error)
+	style(name string) (*reader.Style, bool)
+}
+
+// faceMu guard the font faces while the text is drawn, they aren't safe
+// for concurrent use (see Script.ForEachLine)
+var faceMu sync.Mutex
+
+// spanStyle the style in effect in a span of text of a Line:
+// the Line style changed by the override tags before it
+type spanStyle struct {
+	style   *reader.Style // style restored by \r
+	font    string
+	size    float64
+	scale   [2]float64
+	spacing float64
+	weight  int
+	italic  bool
+	face    font.Face
+	ascent  float64 // scaled
+	descent float64
+
+	vertical    bool    // vertical font (@name), see upright
+	vertAdvance float64 // advance of the upright chars
+}
+
+// newSpanStyle get the spanStyle of a reader.Style
+func newSpanStyle(style *reader.Style, fonts fontLoader) (*spanStyle, error) {
+	s := styleSpan(style)
+	if err := s.load(fonts, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// styleSpan get the spanStyle of a reader.Style, without its font face
+func styleSpan(style *reader.Style) *spanStyle {
+	weight, italic := fontStyle(style)
+	return &spanStyle{
+		style:   style,
+		font:    style.FontName,
+		size:    float64(style.FontSize),
+		scale:   style.Scale,
+		spacing: style.Spacing,
+		weight:  weight,
+		italic:  italic,
+	}
+}
+
+// load the font face of the spanStyle. Like the renderers, a missing
+// font is replaced by the font of prev (the span before the tags), then
+// by the font of the style. The fonts of the styles are loaded by
+// NewEffect, without prev the error is returned if it's missing.
+func (s *spanStyle) load(fonts fontLoader, prev *spanStyle) error {
+	face, err := fonts.face(s.font, s.size, s.weight, s.italic)
+	if err != nil {
+		var names []string
+		if prev != nil {
+			names = append(names, prev.font)
+		}
+		for _, name := range append(names, s.style.FontName) {
+			face, err = fonts.face(name, s.size, s.weight, s.italic)
+			if err == nil {
+				s.font = name
+				break
+			}
+		}
+	}
+	if err != nil {
+		if prev == nil {
+			return err
+		}
+		// keep the face of the previous span
+		s.font, face = prev.font, prev.face
+	}
+	s.face = face
+	ext := utils.Measure(s.face, "", s.scale, s.spacing, false)
+	s.ascent, s.descent = ext.Ascent, ext.Descent
+	s.vertical = strings.HasPrefix(s.font, "@")
+	if s.vertical {
+		// the height of the font, like FreeType without vertical metrics
+		height := utils.Measure(s.face, "", [2]float64{100, 100}, 0, false).Height
+		s.vertAdvance = (height + s.spacing) * s.scale[0] / 100
+	}
+	return nil
+}
+
+// apply the override tags, the layout tags (\fn, \fs, \fscx, \fscy,
+// \fsp, \b, \i, \r) change a copy of the spanStyle.
+// The animated values of \t aren't used.
+func (s *spanStyle) apply(tags []*asstags.Tag, base *reader.Style,
+	fonts fontLoader) *spanStyle {
+	if len(tags) == 0 {
+		return s
+	}
+	n := *s
+	changed := false
+	for _, tag := range tags {
+		if n.applyTag(tag, base, fonts) {
+			changed = true
+		}
+	}
+	if !changed {
+		return s
+	}
+	n.load(fonts, s)
+	return &n
+}
+
+// applyTag apply an override tag,
+// a tag without value restore the value of the style
+func (s *spanStyle) applyTag(tag *asstags.Tag, base *reader.Style,
+	fonts fontLoader) bool {
+
+	v, err := tag.Float()
+	reset := tag.Value == ""
+	switch tag.Name {
+	case "fn":
+		s.font = tag.Value
+		if reset {
+			s.font = s.style.FontName
+		}
+		return true
+	case "r":
+		style := base
+		if sty, ok := fonts.style(tag.Value); ok {
+			style = sty
+		}
+		// loaded by apply
+		*s = *styleSpan(style)
+		return true
+	}
+	if err != nil && !reset {
+		return false
+	}
+
+	switch tag.Name {
+	case "fscx", "fscy":
+		i := 0
+		if tag.Name == "fscy" {
+			i = 1
+		}
+		if reset {
+			v = s.style.Scale[i]
+		}
+		s.scale[i] = v
+	case "fsp":
+		if reset {
+			v = s.style.Spacing
+		}
+		s.spacing = v
+	case "fs":
+		if reset || v <= 0 {
+			v = float64(s.style.FontSize)
+		}
+		s.size = v
+	case "b":
+		if reset {
+			s.weight, _ = fontStyle(s.style)
+		} else {
+			s.weight = fontcache.Weight(int(v))
+		}
+	case "i":
+		s.italic = v != 0
+		if reset {
+			s.italic = s.style.Italic
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package template
+
+import (
+	"github.com/Alquimista/eyecandy"
+	"github.com/Alquimista/eyecandy/asstime"
+	"github.com/Alquimista/eyecandy/expr"
+)
+
+// exprEvaluator an Evaluator of the expr language, the parsed
+// expressions and code are cached
+type exprEvaluator struct {
+	builtins *expr.Env
+	exprs    map[string]*expr.Expr
+	codes    map[string]*expr.Code
+}
+
+// NewEvaluator create an Evaluator of the expr language. The expressions
+// see the variables of the code lines, j and maxj (the loop of the
+// template), and the objects line, syl, char and furi with the fields
+// layer, style, actor, text, i, start, end, mid, dur, kdur, left, center,
+// right, top, middle, bottom, x, y, width and height (the times of the
+// units are from the start of the line, like the inline variables).
+func NewEvaluator() Evaluator {
+	return &exprEvaluator{
+		builtins: expr.Builtins(),
+		exprs:    make(map[string]*expr.Expr),
+		codes:    make(map[string]*expr.Code),
+	}
+}
+
+// Eval evaluate an expression
+func (x *exprEvaluator) Eval(src string, env *Env) (string, error) {
+	e, ok := x.exprs[src]
+	if !ok {
+		var err error
+		if e, err = expr.Parse(src); err != nil {
+			return "", err
+		}
+		x.exprs[src] = e
+	}
+	v, err := e.Eval(x.env(env))
+	if err != nil {
+		return "", err
+	}
+	return expr.String(v), nil
+}
+
+// Exec run a code line, the assignments set the Vars of the env
+func (x *exprEvaluator) Exec(src string, env *Env) error {
+	c, ok := x.codes[src]
+	if !ok {
+		var err error
+		if c, err = expr.ParseCode(src); err != nil {
+			return err
+		}
+		x.codes[src] = c
+	}
+	return c.Run(x.env(env))
+}
+
+// env bind an Env to the expressions: the Vars of the code lines,
+// then the units, then the builtins
+func (x *exprEvaluator) env(env *Env) *expr.Env {
+	units := expr.NewEnv(nil, x.builtins)
+	units.Set("j", float64(env.Loop))
+	units.Set("maxj", float64(env.MaxLoop))
+	if l := env.Line; l != nil {
+		units.Set("line", object(&l.Dialog, 0, env.Index))
+		if env.Syl != nil {
+			units.Set("syl", object(&env.Syl.Dialog, l.StartTime, env.SylI))
+		}
+		if env.Char != nil {
+			units.Set("char", object(&env.Char.Dialog, l.StartTime,
+				env.CharI))
+		}
+		if env.Furi != nil {
+			units.Set("furi", object(&env.Furi.Dialog, l.StartTime,
+				env.FuriI))
+		}
+	}
+	return expr.NewEnv(env.Vars, units)
+}
+
+// object convert a unit into an object of the expressions,
+// the times from origin
+func object(d *eyecandy.Dialog, origin asstime.Time,
+	index int) map[string]interface{} {
+	return map[string]interface{}{
+		"layer":  float64(d.Layer),
+		"style":  d.StyleName,
+		"actor":  d.Actor,
+		"text":   d.Text,
+		"i":      float64(index),
+		"start":  float64(d.StartTime - origin),
+		"end":    float64(d.EndTime - origin),
+		"mid":    float64(d.StartTime + d.Duration/2 - origin),
+		"dur":    float64(d.Duration),
+		"kdur":   float64(d.Duration / asstime.Centisecond),
+		"left":   d.Left,
+		"center": d.Center,
+		"right":  d.Right,
+		"top":    d.Top,
+		"middle": d.Middle,
+		"bottom": d.Bottom,
+		"x":      d.X,
+		"y":      d.Y,
+		"width":  d.Width,
+		"height": d.Height,
+	}
+}
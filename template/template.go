@@ -0,0 +1,441 @@
+// Package template apply karaoke templates to the lines of a Script,
+// like the Aegisub karaoke templater. The templates are commented lines
+// with the Effect "template CLASS [MODIFIERS]" (CLASS is pre-line, line,
+// syl, char or furi), their text is written for each line, syllable,
+// char or furigana of the karaoke lines of the same style, after the
+// inline variables ($x, $start...) and expressions (!expr!) are expanded.
+// The "code CLASS" lines (CLASS is once, line, syl, char or furi) are
+// run by the Evaluator before the templates of each line or unit, by
+// default in the expr language (see NewEvaluator).
+package template
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Alquimista/eyecandy"
+)
+
+// Template classes
+const (
+	ClassOnce    = "once" // only the code lines
+	ClassPreLine = "pre-line"
+	ClassLine    = "line"
+	ClassSyl     = "syl"
+	ClassChar    = "char"
+	ClassFuri    = "furi"
+)
+
+// EffectFx the Effect of the generated lines
+const EffectFx = "fx"
+
+var reVar = regexp.MustCompile(`\$([a-z_]+)`)
+
+// Env the environment of a template: the karaoke Line and the unit in
+// process, and the variables set by the code lines
+type Env struct {
+	Line    *eyecandy.Line
+	Syl     *eyecandy.Syl  // of the Char in char templates, nil in pre-line
+	Char    *eyecandy.Char // only in the char templates
+	Furi    *eyecandy.Furi // only in the furi templates
+	Index   int            // of the Line in the Script, from 1
+	SylI    int            // of the syllable in the Line, from 1 (Syl.Index+1)
+	CharI   int            // of the Char in the Line, from 1
+	FuriI   int            // of the Furi in the Line, from 1
+	Loop    int            // iteration of a "loop N" template, from 1
+	MaxLoop int
+	Vars    map[string]interface{} // shared by all the templates
+}
+
+// Evaluator evaluate the inline expressions (!expr!) of the templates
+// and run the code lines
+type Evaluator interface {
+	Eval(expr string, env *Env) (string, error)
+	Exec(code string, env *Env) error
+}
+
+// Error an error of a template, or of its expressions and code
+type Error struct {
+	Line   int // of the template in the script, from 1
+	Effect string
+	Err    error
+}
+
+// Error get the Error as a String
+func (e *Error) Error() string {
+	return fmt.Sprintf("template: line %d (%s): %s", e.Line, e.Effect, e.Err)
+}
+
+// Unwrap get the error of the template
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// template a template or code line
+type template struct {
+	line    int // in the script
+	effect  string
+	code    bool
+	class   string
+	style   string
+	layer   int
+	text    string
+	all     bool // of all the styles
+	noblank bool // skip the units without text or duration
+	notext  bool // without the text of the unit
+	loop    int
+}
+
+// error wrap an error of the template
+func (t *template) error(err error) error {
+	return &Error{Line: t.line, Effect: t.effect, Err: err}
+}
+
+// warn log a warning about the template
+func (t *template) warn(format string, args ...interface{}) {
+	log.Printf("template: line %d (%s): %s", t.line, t.effect,
+		fmt.Sprintf(format, args...))
+}
+
+// match get if the template is applied to a Line
+func (t *template) match(line *eyecandy.Line) bool {
+	return t.all || t.style == line.StyleName
+}
+
+// parse parse a commented line, nil if it isn't a template.
+// The Aegisub modifiers not supported (fxgroup, keeptags and multi)
+// are ignored with a warning.
+func parse(d *eyecandy.Dialog) (*template, error) {
+	fields := strings.Fields(d.Effect)
+	if len(fields) == 0 || fields[0] != "template" && fields[0] != "code" {
+		return nil, nil
+	}
+	t := &template{
+		line:   d.ScriptLine,
+		effect: d.Effect,
+		code:   fields[0] == "code",
+		class:  ClassSyl,
+		style:  d.StyleName,
+		layer:  d.Layer,
+		text:   d.Text,
+		loop:   1,
+	}
+	if t.code {
+		t.class = ClassOnce
+	}
+	fields = fields[1:]
+	if len(fields) > 0 {
+		switch fields[0] {
+		case ClassOnce:
+			if !t.code {
+				return nil, t.error(fmt.Errorf("invalid class %q", fields[0]))
+			}
+			fallthrough
+		case ClassPreLine, ClassLine, ClassSyl, ClassChar, ClassFuri:
+			t.class = fields[0]
+			fields = fields[1:]
+		}
+	}
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "all":
+			t.all = true
+		case "noblank":
+			t.noblank = true
+		case "notext":
+			t.notext = true
+		case "loop", "repeat":
+			if i+1 == len(fields) {
+				return nil, t.error(fmt.Errorf("%s without count", fields[i]))
+			}
+			i++
+			loop, err := strconv.Atoi(fields[i])
+			if err != nil || loop < 1 {
+				return nil, t.error(fmt.Errorf("invalid loop count %q",
+					fields[i]))
+			}
+			t.loop = loop
+		case "fxgroup":
+			if i+1 < len(fields) {
+				i++
+			}
+			t.warn("modifier fxgroup not supported, ignored")
+		case "keeptags", "multi":
+			t.warn("modifier %s not supported, ignored", fields[i])
+		default:
+			return nil, t.error(fmt.Errorf("invalid modifier %q", fields[i]))
+		}
+	}
+	return t, nil
+}
+
+// templater apply the templates of a Script
+type templater struct {
+	fx        *eyecandy.Script
+	eval      Evaluator
+	templates []*template
+	vars      map[string]interface{}
+}
+
+// isKaraoke get if a Line is a karaoke line:
+// its Effect is empty or "karaoke"
+func isKaraoke(line *eyecandy.Line) bool {
+	return line.Effect == "" ||
+		strings.Contains(strings.ToLower(line.Effect), "karaoke")
+}
+
+// Apply apply the templates of a Script to its karaoke lines (the lines
+// with an empty or "karaoke" Effect), the generated lines are added to
+// the Script with the Effect "fx". A nil eval use NewEvaluator.
+func Apply(fx *eyecandy.Script, eval Evaluator) error {
+	if eval == nil {
+		eval = NewEvaluator()
+	}
+	t := &templater{fx: fx, eval: eval, vars: make(map[string]interface{})}
+	for _, d := range fx.Commented() {
+		tpl, err := parse(d)
+		if err != nil {
+			return err
+		}
+		if tpl != nil {
+			t.templates = append(t.templates, tpl)
+		}
+	}
+
+	env := &Env{Vars: t.vars}
+	if err := t.run(ClassOnce, env); err != nil {
+		return err
+	}
+	for i, line := range fx.Lines() {
+		if !isKaraoke(line) {
+			continue
+		}
+		if err := t.applyLine(line, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyLine apply the templates to a karaoke Line
+func (t *templater) applyLine(line *eyecandy.Line, index int) error {
+	env := &Env{Line: line, Index: index, Vars: t.vars}
+	syls := line.Syls()
+
+	if err := t.run(ClassLine, env); err != nil {
+		return err
+	}
+	err := t.each(ClassPreLine, env, func(tpl *template, e *Env) error {
+		text, err := t.expand(tpl, e)
+		if err != nil {
+			return err
+		}
+		if !tpl.notext {
+			text += line.Text
+		}
+		t.add(tpl, line, line.StyleName, text)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = t.each(ClassLine, env, func(tpl *template, e *Env) error {
+		text := ""
+		for _, syl := range syls {
+			e.Syl, e.SylI = syl, syl.Index+1
+			s, err := t.expand(tpl, e)
+			if err != nil {
+				return err
+			}
+			text += syl.PreSpace + s
+			if !tpl.notext {
+				text += syl.Text
+			}
+			text += syl.PostSpace
+		}
+		e.Syl, e.SylI = nil, 0
+		t.add(tpl, line, line.StyleName, text)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, syl := range syls {
+		e := *env
+		e.Syl, e.SylI = syl, syl.Index+1
+		blank := strings.TrimSpace(syl.Text) == "" || syl.Duration <= 0
+		if err := t.applyUnit(ClassSyl, &e, blank, line.StyleName,
+			syl.Text); err != nil {
+			return err
+		}
+	}
+	for i, char := range line.Chars() {
+		e := *env
+		e.Char, e.CharI = char, i+1
+		syl := syls[char.SylIndex]
+		e.Syl, e.SylI = syl, syl.Index+1
+		blank := strings.TrimSpace(char.Text) == "" || char.Duration <= 0
+		if err := t.applyUnit(ClassChar, &e, blank, line.StyleName,
+			char.Text); err != nil {
+			return err
+		}
+	}
+	for i, furi := range line.Furi() {
+		e := *env
+		e.Furi, e.FuriI = furi, i+1
+		blank := furi.Duration <= 0
+		if err := t.applyUnit(ClassFuri, &e, blank, furi.StyleName,
+			furi.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyUnit apply the templates of a class to a syllable, char or
+// furigana, one line for each of them
+func (t *templater) applyUnit(class string, env *Env, blank bool,
+	style, text string) error {
+	if err := t.run(class, env); err != nil {
+		return err
+	}
+	return t.each(class, env, func(tpl *template, e *Env) error {
+		if tpl.noblank && blank {
+			return nil
+		}
+		s, err := t.expand(tpl, e)
+		if err != nil {
+			return err
+		}
+		if !tpl.notext {
+			s += text
+		}
+		t.add(tpl, env.Line, style, s)
+		return nil
+	})
+}
+
+// run run the code lines of a class
+func (t *templater) run(class string, env *Env) error {
+	for _, tpl := range t.templates {
+		if !tpl.code || tpl.class != class ||
+			env.Line != nil && !tpl.match(env.Line) {
+			continue
+		}
+		if err := t.eval.Exec(tpl.text, env); err != nil {
+			return tpl.error(err)
+		}
+	}
+	return nil
+}
+
+// each call f for every template of a class applied to the Line
+// of the env, and every loop of the template
+func (t *templater) each(class string, env *Env,
+	f func(tpl *template, e *Env) error) error {
+	for _, tpl := range t.templates {
+		if tpl.code || tpl.class != class || !tpl.match(env.Line) {
+			continue
+		}
+		for j := 1; j <= tpl.loop; j++ {
+			e := *env
+			e.Loop, e.MaxLoop = j, tpl.loop
+			if err := f(tpl, &e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// expand expand the inline variables ($name) of the text of a template,
+// and then its expressions (!expr!). Unknown variables are kept.
+func (t *templater) expand(tpl *template, env *Env) (string, error) {
+	text := reVar.ReplaceAllStringFunc(tpl.text, func(m string) string {
+		if v, ok := variable(env, m[1:]); ok {
+			return v
+		}
+		return m
+	})
+	text, err := expressions(text, func(src string) (string, error) {
+		v, err := t.eval.Eval(src, env)
+		if err != nil {
+			return "", fmt.Errorf("expression !%s!: %s", src, err)
+		}
+		return v, nil
+	})
+	if err != nil {
+		return "", tpl.error(err)
+	}
+	return text, nil
+}
+
+// expressions replace the expressions (!expr!) of a text by the result
+// of f. The "!" inside the strings of an expression don't end it, and
+// like in Aegisub a "!" without its closing one is kept as text.
+func expressions(text string,
+	f func(src string) (string, error)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		if text[i] != '!' {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+		end := exprEnd(text, i+1)
+		if end < 0 {
+			b.WriteString(text[i:])
+			break
+		}
+		v, err := f(text[i+1 : end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+		i = end + 1
+	}
+	return b.String(), nil
+}
+
+// exprEnd get the index of the "!" ending an expression started at
+// start, skipping its strings (the quote and the backslash are escaped
+// like in expr), -1 if it isn't closed
+func exprEnd(text string, start int) int {
+	for j := start; j < len(text); j++ {
+		switch c := text[j]; c {
+		case '!':
+			return j
+		case '"', '\'':
+			for j++; j < len(text) && text[j] != c; j++ {
+				if text[j] == '\\' && j+1 < len(text) &&
+					(text[j+1] == c || text[j+1] == '\\') {
+					j++
+				}
+			}
+			if j == len(text) {
+				return -1
+			}
+		}
+	}
+	return -1
+}
+
+// add add a generated line, with the times of the karaoke Line
+// and the layer of the template
+func (t *templater) add(tpl *template, line *eyecandy.Line, style,
+	text string) {
+	t.fx.Add(eyecandy.Line{Dialog: eyecandy.Dialog{
+		Layer:     tpl.layer,
+		StartTime: line.StartTime,
+		EndTime:   line.EndTime,
+		StyleName: style,
+		Actor:     line.Actor,
+		Margin:    line.Margin,
+		Effect:    EffectFx,
+		Text:      text,
+	}})
+}
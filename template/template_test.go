@@ -0,0 +1,309 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Alquimista/eyecandy"
+	"github.com/Alquimista/eyecandy/fontcache"
+	"github.com/Alquimista/eyecandy/reader"
+)
+
+// karaLine the syllables AV (0-200ms), an empty one (200-300ms), " g"
+// (300-600ms), V of zero duration and A (600ms to the end). With the
+// test font at 60px A and V are 30px wide, g 25px and the space 12.5px.
+const karaLine = `Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,` +
+	`{\k20}AV{\k10}{\k30} g{\k0}V{\k50}A`
+
+var addTestFont sync.Once
+
+// apply apply the templates (Comment lines) to the karaoke lines
+// (Dialogue lines) and get the text of the generated lines
+func apply(t *testing.T, events string) ([]string, error) {
+	t.Helper()
+	addTestFont.Do(func() {
+		src, err := ioutil.ReadFile(
+			filepath.Join("..", "utils", "testdata", "eyecandy-test.ttf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fontcache.Default.AddFont("eyecandy-test.ttf", src); err != nil {
+			t.Fatal(err)
+		}
+	})
+	src := "[Script Info]\nScriptType: v4.00+\nWrapStyle: 2\n" +
+		"PlayResX: 1200\nPlayResY: 900\n\n" +
+		"[V4+ Styles]\n" +
+		"Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, " +
+		"OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, " +
+		"ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, " +
+		"Alignment, MarginL, MarginR, MarginV, Encoding\n" +
+		"Style: Default,Eyecandy Test,60,&H00FFFFFF,&H000000FF,&H00000000," +
+		"&H00000000,0,0,0,0,100,100,0,0,1,0,0,7,10,20,30,1\n\n" +
+		"[Events]\n" +
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, " +
+		"MarginV, Effect, Text\n" + events + "\n"
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in.ass")
+	if err := ioutil.WriteFile(in, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fx := eyecandy.NewEffect(in)
+	if err := Apply(fx, nil); err != nil {
+		return nil, err
+	}
+	out := filepath.Join(dir, "out.ass")
+	if err := fx.Save(out); err != nil {
+		t.Fatal(err)
+	}
+	s, err := reader.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, d := range s.Dialog {
+		if d.Effect == EffectFx && !d.Comment {
+			texts = append(texts, d.Text)
+		}
+	}
+	return texts, nil
+}
+
+// tpl a template Comment line of the Default style
+func tpl(effect, text string) string {
+	return tplStyle("Default", effect, text)
+}
+
+func tplStyle(style, effect, text string) string {
+	return fmt.Sprintf("Comment: 0,0:00:00.00,0:00:00.00,%s,,0,0,0,%s,%s",
+		style, effect, text)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   []string
+	}{
+		{
+			"syl",
+			[]string{tpl("template syl", `{\pos($x,$y)\k$kdur}`), karaLine},
+			[]string{`{\pos(10,30)\k20}AV`, `{\pos(82.5,30)\k30}g`,
+				`{\pos(107.5,30)\k0}V`, `{\pos(137.5,30)\k50}A`},
+		},
+		{
+			"default class",
+			[]string{tpl("template", "$si/$syln-"), karaLine},
+			[]string{"1/5-AV", "3/5-g", "4/5-V", "5/5-A"},
+		},
+		{
+			"noblank",
+			[]string{tpl("template syl noblank", "x"), karaLine},
+			[]string{"xAV", "xg", "xA"},
+		},
+		{
+			"notext",
+			[]string{tpl("template syl notext", "$i:$start-$end"), karaLine},
+			[]string{"1:0-200", "3:300-600", "4:600-600", "5:600-1000"},
+		},
+		{
+			"loop",
+			[]string{tpl("template line loop 2", "!j!/!maxj!"), karaLine},
+			[]string{"1/2AV 1/2g1/2V1/2A", "2/2AV 2/2g2/2V2/2A"},
+		},
+		{
+			"repeat",
+			[]string{tpl("template syl repeat 3 notext", "!syl.i!.!j!"),
+				`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\k20}A`},
+			[]string{"1.1", "1.2", "1.3"},
+		},
+		{
+			"pre-line",
+			[]string{tpl("template pre-line", `{\fad(100,0)}`), karaLine},
+			[]string{`{\fad(100,0)}AV gVA`},
+		},
+		{
+			"pre-line notext",
+			[]string{tpl("template pre-line notext", "$li $lwidth"),
+				karaLine},
+			[]string{"1 157.5"},
+		},
+		{
+			"char",
+			[]string{tpl("template char notext", "$si.$i $sleft $left"),
+				karaLine},
+			[]string{"1.1 10 10", "1.2 10 40", "3.3 82.5 82.5",
+				"4.4 107.5 107.5", "5.5 137.5 137.5"},
+		},
+		{
+			"style",
+			[]string{tplStyle("Other", "template syl", "x"), karaLine},
+			nil,
+		},
+		{
+			"all",
+			[]string{tplStyle("Other", "template syl all notext", "x"),
+				karaLine},
+			[]string{"x", "x", "x", "x"},
+		},
+		{
+			"code",
+			[]string{
+				tpl("code once", "n = 10"),
+				tpl("code syl", "n = n + 1"),
+				tpl("template syl notext", "!n!"),
+				karaLine,
+			},
+			[]string{"11", "12", "13", "14"},
+		},
+		{
+			"code line",
+			[]string{
+				tpl("code line", "w = line.width * 2"),
+				tpl("template pre-line notext", "!w!"),
+				karaLine,
+			},
+			[]string{"315"},
+		},
+		{
+			"not karaoke",
+			[]string{tpl("template pre-line notext", "x"),
+				`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,fx,A`,
+				`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,karaoke,A`},
+			[]string{"x"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := apply(t, strings.Join(tt.events, "\n"))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	const text = "$layer|$style|$actor|$margin_l|$margin_r|$margin_v|" +
+		"$margin_t|$margin_b|$syln|$li|$lstart|$lend|$lmid|$ldur|$lkdur|" +
+		"$lleft|$lcenter|$lright|$ltop|$lmiddle|$lbottom|$lx|$ly|" +
+		"$lwidth|$lheight|$sstart|$send|$sdur|$skdur|$si|$sx|" +
+		"$start|$end|$mid|$dur|$kdur|$i|$width|$height|$unknown|$"
+	const line = `Dialogue: 2,0:00:01.00,0:00:02.00,Default,Me,0,5,0,,` +
+		`{\k20}AV{\k80}g`
+	got, err := apply(t, tpl("template char notext", text)+"\n"+line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2|Default|Me|10|5|30|30|30|2|1|1000|2000|1500|1000|100|" +
+			"10|52.5|95|30|60|90|10|30|85|60|0|200|200|20|1|10|" +
+			"0|100|50|100|10|1|30|60|$unknown|$",
+		"2|Default|Me|10|5|30|30|30|2|1|1000|2000|1500|1000|100|" +
+			"10|52.5|95|30|60|90|10|30|85|60|0|200|200|20|1|10|" +
+			"100|200|150|100|10|2|30|60|$unknown|$",
+		"2|Default|Me|10|5|30|30|30|2|1|1000|2000|1500|1000|100|" +
+			"10|52.5|95|30|60|90|10|30|85|60|200|1000|800|80|2|70|" +
+			"200|1000|600|800|80|3|25|60|$unknown|$",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestModifierErrors(t *testing.T) {
+	tests := []struct {
+		effect string
+		err    string
+	}{
+		{"template syl bogus", `invalid modifier "bogus"`},
+		{"template syl loop", "loop without count"},
+		{"template syl loop x", `invalid loop count "x"`},
+		{"template syl repeat 0", `invalid loop count "0"`},
+		{"template once", `invalid class "once"`},
+	}
+	for _, tt := range tests {
+		_, err := apply(t, tpl(tt.effect, "x")+"\n"+karaLine)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: error = %v, want a *Error", tt.effect, err)
+			continue
+		}
+		want := fmt.Sprintf("template: line 13 (%s): %s", tt.effect, tt.err)
+		if e.Line != 13 || e.Effect != tt.effect || e.Error() != want {
+			t.Errorf("%s: error = %q (line %d), want %q", tt.effect,
+				e.Error(), e.Line, want)
+		}
+	}
+}
+
+func TestUnsupportedModifiers(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	got, err := apply(t, strings.Join([]string{
+		tpl("template syl fxgroup glow notext", "a"),
+		tpl("template syl keeptags notext", "b"),
+		tpl("template line multi notext", "c"),
+		`Dialogue: 0,0:00:01.00,0:00:02.00,Default,,0,0,0,,{\k20}A`,
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, want := range []string{
+		"template: line 13 (template syl fxgroup glow notext): " +
+			"modifier fxgroup not supported, ignored",
+		"template: line 14 (template syl keeptags notext): " +
+			"modifier keeptags not supported, ignored",
+		"template: line 15 (template line multi notext): " +
+			"modifier multi not supported, ignored",
+	} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("warning %q not logged:\n%s", want, logged.String())
+		}
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"!1 + 2!", "3"},
+		{"a!1!b!2!c", "a1b2c"},
+		{"Hi!", "Hi!"},
+		{"!1! and !", "1 and !"},
+		{`!"a!b"!`, "a!b"},
+		{`!"a\"!"!`, `a"!`},
+		{`!"open`, `!"open`},
+	}
+	for _, tt := range tests {
+		got, err := expressions(tt.text, func(src string) (string, error) {
+			return NewEvaluator().Eval(src, &Env{})
+		})
+		if err != nil || got != tt.want {
+			t.Errorf("expressions(%q) = %q, %v, want %q", tt.text, got, err,
+				tt.want)
+		}
+	}
+
+	_, err := apply(t, tpl("template syl", "!1 +!")+"\n"+karaLine)
+	var e *Error
+	if !errors.As(err, &e) || !strings.Contains(e.Error(), "expression !1 +!") {
+		t.Errorf("invalid expression: error = %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package template
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Alquimista/eyecandy"
+	"github.com/Alquimista/eyecandy/asstime"
+	"github.com/Alquimista/eyecandy/utils"
+)
+
+// variable get the value of an inline variable in the env, like the
+// Aegisub ones: $layer, $style, $actor, $margin_l, $margin_r, $margin_v
+// ($margin_t, $margin_b), $syln, $li and the variables of a unit:
+// $start, $end, $mid, $dur, $kdur (in centiseconds), $i, $left, $center,
+// $right, $top, $middle, $bottom, $x, $y, $width and $height.
+// The unit variables are of the Line with the prefix "l" ($lstart), of
+// the syllable with the prefix "s" ($sx) and else of the unit of the
+// template: the syllable, char or furigana (the Line in the pre-line
+// templates). The times are in milliseconds, the ones of the units
+// from the start of the Line.
+func variable(env *Env, name string) (string, bool) {
+	l := env.Line
+	if l == nil {
+		return "", false
+	}
+	switch name {
+	case "layer":
+		return strconv.Itoa(l.Layer), true
+	case "style":
+		return l.StyleName, true
+	case "actor":
+		return l.Actor, true
+	case "margin_l":
+		return strconv.Itoa(margin(l, 0)), true
+	case "margin_r":
+		return strconv.Itoa(margin(l, 1)), true
+	case "margin_v", "margin_t", "margin_b":
+		return strconv.Itoa(margin(l, 2)), true
+	case "syln":
+		return strconv.Itoa(l.SylN), true
+	}
+
+	if strings.HasPrefix(name, "l") {
+		if v, ok := unitVariable(&l.Dialog, name[1:], 0, env.Index); ok {
+			return v, true
+		}
+	}
+	if strings.HasPrefix(name, "s") && env.Syl != nil {
+		if v, ok := unitVariable(&env.Syl.Dialog, name[1:], l.StartTime,
+			env.SylI); ok {
+			return v, true
+		}
+	}
+	switch {
+	case env.Char != nil:
+		return unitVariable(&env.Char.Dialog, name, l.StartTime, env.CharI)
+	case env.Furi != nil:
+		return unitVariable(&env.Furi.Dialog, name, l.StartTime, env.FuriI)
+	case env.Syl != nil:
+		return unitVariable(&env.Syl.Dialog, name, l.StartTime, env.SylI)
+	}
+	return unitVariable(&l.Dialog, name, l.StartTime, env.Index)
+}
+
+// margin get a margin of a Line, of its style when it's zero
+func margin(l *eyecandy.Line, i int) int {
+	if l.Margin[i] != 0 {
+		return l.Margin[i]
+	}
+	return l.Style.Margin[i]
+}
+
+// unitVariable get the value of a variable of a unit,
+// the times from origin
+func unitVariable(d *eyecandy.Dialog, name string, origin asstime.Time,
+	index int) (string, bool) {
+	switch name {
+	case "start":
+		return strconv.Itoa(int(d.StartTime - origin)), true
+	case "end":
+		return strconv.Itoa(int(d.EndTime - origin)), true
+	case "mid":
+		return strconv.Itoa(int(d.StartTime + d.Duration/2 - origin)), true
+	case "dur":
+		return strconv.Itoa(int(d.Duration)), true
+	case "kdur":
+		return strconv.Itoa(int(d.Duration / asstime.Centisecond)), true
+	case "i":
+		return strconv.Itoa(index), true
+	case "left":
+		return number(d.Left), true
+	case "center":
+		return number(d.Center), true
+	case "right":
+		return number(d.Right), true
+	case "top":
+		return number(d.Top), true
+	case "middle":
+		return number(d.Middle), true
+	case "bottom":
+		return number(d.Bottom), true
+	case "x":
+		return number(d.X), true
+	case "y":
+		return number(d.Y), true
+	case "width":
+		return number(d.Width), true
+	case "height":
+		return number(d.Height), true
+	}
+	return "", false
+}
+
+// number format a number of a variable
+func number(f float64) string {
+	return strconv.FormatFloat(utils.Round(f, 3), 'f', -1, 64)
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Face a font face sized like libass and VSFilter: the font size is
+// the height of the font (ascent + descent), not its em size
+type Face struct {
+	font.Face
+	Font    *sfnt.Font    // outlines of the glyphs
+	PPEM    fixed.Int26_6 // em size in pixels
+	Size    float64       // font size in pixels
+	Ascent  float64       // pixels over the baseline
+	Descent float64       // pixels under the baseline
+}
+
+// Kern get the kerning of a pair of chars in pixels. opentype.Face scale
+// it by the units per em instead of the em size.
+func (f *Face) Kern(r0, r1 rune) fixed.Int26_6 {
+	var buf sfnt.Buffer
+	x0, err := f.Font.GlyphIndex(&buf, r0)
+	if err != nil {
+		return 0
+	}
+	x1, err := f.Font.GlyphIndex(&buf, r1)
+	if err != nil {
+		return 0
+	}
+	k, err := f.Font.Kern(&buf, x0, x1, f.PPEM, font.HintingNone)
+	if err != nil {
+		return 0
+	}
+	return k
+}
+
+// Extents metrics of a text in pixels, scaled by the style
+type Extents struct {
+	Width   float64 // advance width, with the spacing of every char
+	Height  float64 // Ascent + Descent
+	Ascent  float64
+	Descent float64
+	// Ink bounds of the glyphs: Left, Top, Right, Bottom
+	// from the origin of the text on the baseline (Y down)
+	Ink [4]float64
+}
+
+// Bounds get the Ink bounds grown by the border, and the shadow
+// (shifted to the right and bottom)
+func (e Extents) Bounds(bord, shadow float64) [4]float64 {
+	return [4]float64{
+		e.Ink[0] - bord + math.Min(shadow, 0),
+		e.Ink[1] - bord + math.Min(shadow, 0),
+		e.Ink[2] + bord + math.Max(shadow, 0),
+		e.Ink[3] + bord + math.Max(shadow, 0),
+	}
+}
+
+// fontHeight get the ascent and descent of a font face
+func fontHeight(ff font.Face) (ascent, descent float64) {
+	if f, ok := ff.(*Face); ok {
+		return f.Ascent, f.Descent
+	}
+	m := ff.Metrics()
+	return fixedToFloat(m.Ascent), fixedToFloat(m.Descent)
+}
+
+func fixedToFloat(x fixed.Int26_6) float64 {
+	return float64(x) / 64
+}
+
+// Measure get the Extents of a text like libass: scale in percent
+// (ScaleX, ScaleY), spacing in pixels added after every char
+// (scaled by ScaleX) and the kerning pairs of the font if kerning.
+func Measure(ff font.Face, s string, scale [2]float64, spacing float64,
+	kerning bool) (e Extents) {
+
+	sx, sy := scale[0]/100.0, scale[1]/100.0
+	ascent, descent := fontHeight(ff)
+	e.Ascent, e.Descent = ascent*sy, descent*sy
+	e.Height = e.Ascent + e.Descent
+
+	x := 0.0
+	prev := rune(-1)
+	inked := false
+	for _, c := range s {
+		if kerning && prev >= 0 {
+			x += fixedToFloat(ff.Kern(prev, c))
+		}
+		bounds, advance, ok := ff.GlyphBounds(c)
+		if ok && bounds.Max.X > bounds.Min.X && bounds.Max.Y > bounds.Min.Y {
+			ink := [4]float64{
+				x + fixedToFloat(bounds.Min.X),
+				fixedToFloat(bounds.Min.Y),
+				x + fixedToFloat(bounds.Max.X),
+				fixedToFloat(bounds.Max.Y),
+			}
+			if !inked {
+				e.Ink, inked = ink, true
+			} else {
+				e.Ink[0] = math.Min(e.Ink[0], ink[0])
+				e.Ink[1] = math.Min(e.Ink[1], ink[1])
+				e.Ink[2] = math.Max(e.Ink[2], ink[2])
+				e.Ink[3] = math.Max(e.Ink[3], ink[3])
+			}
+		}
+		x += fixedToFloat(advance) + spacing
+		prev = c
+	}
+	e.Width = x * sx
+	e.Ink = [4]float64{e.Ink[0] * sx, e.Ink[1] * sy,
+		e.Ink[2] * sx, e.Ink[3] * sy}
+	return e
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"io/ioutil"
+	"math"
+	"sync"
+	"testing"
+
+	"golang.org/x/image/font"
+
+	"github.com/Alquimista/eyecandy/fontcache"
+)
+
+// testdata/eyecandy-test.ttf (see testdata/mkfont.go): 1000 units per
+// em, usWinAscent 900 and usWinDescent 300. Like libass the font size is
+// the sum of both (FT_SIZE_REQUEST_TYPE_REAL_DIM with the GDI metrics),
+// so at 60px the em is 50px and a font unit is 0.05px.
+const testFont = "Eyecandy Test"
+
+var addTestFont sync.Once
+
+func testFace(t *testing.T, size float64) font.Face {
+	t.Helper()
+	addTestFont.Do(func() {
+		src, err := ioutil.ReadFile("testdata/eyecandy-test.ttf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fontcache.Default.AddFont("eyecandy-test.ttf", src); err != nil {
+			t.Fatal(err)
+		}
+	})
+	ff, err := LoadFontStyle(testFont, size, fontcache.WeightRegular, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ff
+}
+
+func TestLoadFontStyle(t *testing.T) {
+	tests := []struct {
+		size            float64
+		ppem            float64
+		ascent, descent float64
+	}{
+		{60, 50, 45, 15},
+		{36, 30, 27, 9},
+		{100, 1000.0 / 12, 75, 25},
+	}
+	for _, tt := range tests {
+		f, ok := testFace(t, tt.size).(*Face)
+		if !ok {
+			t.Fatalf("size %v: LoadFontStyle didn't return a *Face", tt.size)
+		}
+		if got := fixedToFloat(f.PPEM); math.Abs(got-tt.ppem) > 1.0/64 {
+			t.Errorf("size %v: PPEM = %v, want %v", tt.size, got, tt.ppem)
+		}
+		if f.Ascent != tt.ascent || f.Descent != tt.descent {
+			t.Errorf("size %v: Ascent, Descent = %v, %v, want %v, %v",
+				tt.size, f.Ascent, f.Descent, tt.ascent, tt.descent)
+		}
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	ff := testFace(t, 60)
+	tests := []struct {
+		name    string
+		text    string
+		scale   [2]float64
+		spacing float64
+		kerning bool
+		want    Extents
+	}{
+		{"empty", "", [2]float64{100, 100}, 0, false,
+			Extents{0, 60, 45, 15, [4]float64{}}},
+		{"advance", "A", [2]float64{100, 100}, 0, false,
+			Extents{30, 60, 45, 15, [4]float64{2.5, -35, 27.5, 0}}},
+		{"space without ink", " ", [2]float64{100, 100}, 0, false,
+			Extents{12.5, 60, 45, 15, [4]float64{}}},
+		{"descender", "g", [2]float64{100, 100}, 0, false,
+			Extents{25, 60, 45, 15, [4]float64{2, -25, 23, 10}}},
+		{"ink union", "Ag", [2]float64{100, 100}, 0, false,
+			Extents{55, 60, 45, 15, [4]float64{2.5, -35, 53, 10}}},
+		{"without kerning", "AV", [2]float64{100, 100}, 0, false,
+			Extents{60, 60, 45, 15, [4]float64{2.5, -35, 59, 0}}},
+		{"kerning", "AV", [2]float64{100, 100}, 0, true,
+			Extents{55, 60, 45, 15, [4]float64{2.5, -35, 54, 0}}},
+		{"kerning only between the pair", "VA", [2]float64{100, 100}, 0, true,
+			Extents{60, 60, 45, 15, [4]float64{1, -35, 57.5, 0}}},
+		// \fsp is added after every char, the last one too
+		{"spacing", "AV", [2]float64{100, 100}, 2, false,
+			Extents{64, 60, 45, 15, [4]float64{2.5, -35, 61, 0}}},
+		{"spacing and kerning", "AV", [2]float64{100, 100}, 2, true,
+			Extents{59, 60, 45, 15, [4]float64{2.5, -35, 56, 0}}},
+		{"negative spacing", "A A", [2]float64{100, 100}, -5, false,
+			Extents{57.5, 60, 45, 15, [4]float64{2.5, -35, 60, 0}}},
+		// ScaleX scale the advances, the spacing and the kerning
+		{"scale x", "AV", [2]float64{200, 100}, 2, true,
+			Extents{118, 60, 45, 15, [4]float64{5, -35, 112, 0}}},
+		{"scale y", "g", [2]float64{100, 50}, 0, false,
+			Extents{25, 30, 22.5, 7.5, [4]float64{2, -12.5, 23, 5}}},
+		{"scale x and y", "Ag", [2]float64{50, 150}, 0, false,
+			Extents{27.5, 90, 67.5, 22.5, [4]float64{1.25, -52.5, 26.5, 15}}},
+	}
+	for _, tt := range tests {
+		got := Measure(ff, tt.text, tt.scale, tt.spacing, tt.kerning)
+		if !extentsEqual(got, tt.want) {
+			t.Errorf("%s: Measure(%q) = %+v, want %+v",
+				tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExtentsBounds(t *testing.T) {
+	e := Extents{Ink: [4]float64{2.5, -35, 27.5, 0}}
+	tests := []struct {
+		bord, shadow float64
+		want         [4]float64
+	}{
+		{0, 0, [4]float64{2.5, -35, 27.5, 0}},
+		{2, 0, [4]float64{0.5, -37, 29.5, 2}},
+		{2, 3, [4]float64{0.5, -37, 32.5, 5}},
+		{0, -3, [4]float64{-0.5, -38, 27.5, 0}},
+	}
+	for _, tt := range tests {
+		if got := e.Bounds(tt.bord, tt.shadow); got != tt.want {
+			t.Errorf("Bounds(%v, %v) = %v, want %v",
+				tt.bord, tt.shadow, got, tt.want)
+		}
+	}
+}
+
+// extentsEqual compare Extents to 1/64 pixel, the precision of the faces
+func extentsEqual(a, b Extents) bool {
+	near := func(x, y float64) bool {
+		return math.Abs(x-y) <= 1.0/64
+	}
+	if !near(a.Width, b.Width) || !near(a.Height, b.Height) ||
+		!near(a.Ascent, b.Ascent) || !near(a.Descent, b.Descent) {
+		return false
+	}
+	for i := range a.Ink {
+		if !near(a.Ink[i], b.Ink[i]) {
+			return false
+		}
+	}
+	return true
+}
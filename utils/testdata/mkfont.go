@@ -0,0 +1,265 @@
+//go:build ignore
+
+// mkfont write eyecandy-test.ttf, the font of the metrics tests: a
+// TrueType font with known metrics, 1000 units per em, usWinAscent 900
+// and usWinDescent 300 (the font size is 1200 units, like libass and
+// GDI), and four glyphs drawn as rectangles:
+//
+//	glyph  advance  ink (xMin, yMin, xMax, yMax)
+//	space  250      none
+//	A      600      50, 0, 550, 700
+//	V      600      20, 0, 580, 700
+//	g      500      40, -200, 460, 500
+//
+// with a kerning pair A V of -100 units (kern table).
+//
+//	go run mkfont.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+	"sort"
+	"unicode/utf16"
+)
+
+type glyph struct {
+	char    rune
+	advance int
+	box     []int // xMin, yMin, xMax, yMax, nil without outline
+}
+
+var glyphs = []glyph{
+	{0, 500, nil}, // .notdef
+	{' ', 250, nil},
+	{'A', 600, []int{50, 0, 550, 700}},
+	{'V', 600, []int{20, 0, 580, 700}},
+	{'g', 500, []int{40, -200, 460, 500}},
+}
+
+const (
+	unitsPerEm   = 1000
+	winAscent    = 900
+	winDescent   = 300
+	family       = "Eyecandy Test"
+	subfamily    = "Regular"
+	kernA, kernV = 2, 3 // glyph ids
+	kernValue    = -100
+)
+
+func write(b *bytes.Buffer, values ...interface{}) {
+	for _, v := range values {
+		if err := binary.Write(b, binary.BigEndian, v); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func head() []byte {
+	var b bytes.Buffer
+	write(&b, uint32(0x00010000), uint32(0x00010000), uint32(0),
+		uint32(0x5F0F3CF5), uint16(0x000B), uint16(unitsPerEm),
+		int64(0), int64(0), // created, modified
+		int16(0), int16(-200), int16(580), int16(700), // bbox
+		uint16(0), uint16(8), int16(2),
+		int16(1), int16(0)) // long loca, glyf format
+	return b.Bytes()
+}
+
+func hhea() []byte {
+	var b bytes.Buffer
+	write(&b, uint32(0x00010000), int16(800), int16(-200), int16(0),
+		uint16(600), int16(0), int16(-200), int16(580),
+		int16(1), int16(0), int16(0),
+		int16(0), int16(0), int16(0), int16(0), int16(0),
+		uint16(len(glyphs)))
+	return b.Bytes()
+}
+
+func maxp() []byte {
+	var b bytes.Buffer
+	write(&b, uint32(0x00010000), uint16(len(glyphs)), uint16(4), uint16(1),
+		uint16(0), uint16(0), uint16(2), uint16(0), uint16(0), uint16(0),
+		uint16(0), uint16(0), uint16(0), uint16(0), uint16(0))
+	return b.Bytes()
+}
+
+func os2() []byte {
+	var b bytes.Buffer
+	write(&b, uint16(0), int16(500), uint16(400), uint16(5), uint16(0),
+		int16(0), int16(0), int16(0), int16(0), int16(0), int16(0),
+		int16(0), int16(0), int16(50), int16(250), int16(0),
+		make([]byte, 10), // panose
+		uint32(1), uint32(0), uint32(0), uint32(0),
+		[]byte("NONE"), uint16(0x40), uint16(' '), uint16('g'),
+		int16(800), int16(-200), int16(0),
+		uint16(winAscent), uint16(winDescent))
+	return b.Bytes()
+}
+
+func hmtx() []byte {
+	var b bytes.Buffer
+	for _, g := range glyphs {
+		lsb := 0
+		if g.box != nil {
+			lsb = g.box[0]
+		}
+		write(&b, uint16(g.advance), int16(lsb))
+	}
+	return b.Bytes()
+}
+
+func glyfLoca() ([]byte, []byte) {
+	var glyf, loca bytes.Buffer
+	for _, g := range glyphs {
+		write(&loca, uint32(glyf.Len()))
+		if g.box == nil {
+			continue
+		}
+		x0, y0, x1, y1 := g.box[0], g.box[1], g.box[2], g.box[3]
+		write(&glyf, int16(1), int16(x0), int16(y0), int16(x1), int16(y1),
+			uint16(3), uint16(0), // endPts, instructions
+			[]byte{1, 1, 1, 1}, // on curve, long coordinates
+			int16(x0), int16(0), int16(x1-x0), int16(0),
+			int16(y0), int16(y1-y0), int16(0), int16(y0-y1))
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+	}
+	write(&loca, uint32(glyf.Len()))
+	return glyf.Bytes(), loca.Bytes()
+}
+
+func cmap() []byte {
+	// format 4, a segment for each char and the final 0xFFFF
+	var chars []int
+	for _, g := range glyphs[1:] {
+		chars = append(chars, int(g.char))
+	}
+	sort.Ints(chars)
+	gid := map[int]int{}
+	for i, g := range glyphs {
+		gid[int(g.char)] = i
+	}
+	segs := len(chars) + 1
+	var sub bytes.Buffer
+	searchRange, entrySelector := binarySearch(segs, 2)
+	write(&sub, uint16(4), uint16(16+8*segs), uint16(0), uint16(2*segs),
+		searchRange, entrySelector, uint16(2*segs)-searchRange)
+	for _, c := range chars {
+		write(&sub, uint16(c))
+	}
+	write(&sub, uint16(0xFFFF), uint16(0))
+	for _, c := range chars {
+		write(&sub, uint16(c))
+	}
+	write(&sub, uint16(0xFFFF))
+	for _, c := range chars {
+		write(&sub, int16(gid[c]-c))
+	}
+	write(&sub, int16(1))
+	for range chars {
+		write(&sub, uint16(0))
+	}
+	write(&sub, uint16(0))
+
+	var b bytes.Buffer
+	write(&b, uint16(0), uint16(1), uint16(3), uint16(1), uint32(12))
+	b.Write(sub.Bytes())
+	return b.Bytes()
+}
+
+func name() []byte {
+	records := []struct {
+		id    uint16
+		value string
+	}{
+		{1, family}, {2, subfamily}, {4, family + " " + subfamily},
+		{6, "EyecandyTest-Regular"},
+	}
+	var strs bytes.Buffer
+	var b bytes.Buffer
+	write(&b, uint16(0), uint16(len(records)), uint16(6+12*len(records)))
+	for _, r := range records {
+		u := utf16.Encode([]rune(r.value))
+		write(&b, uint16(3), uint16(1), uint16(0x409), r.id,
+			uint16(2*len(u)), uint16(strs.Len()))
+		write(&strs, u)
+	}
+	b.Write(strs.Bytes())
+	return b.Bytes()
+}
+
+func kern() []byte {
+	var b bytes.Buffer
+	write(&b, uint16(0), uint16(1), // version, tables
+		uint16(0), uint16(14+6), uint16(1), // format 0, horizontal
+		uint16(1), uint16(6), uint16(0), uint16(0),
+		uint16(kernA), uint16(kernV), int16(kernValue))
+	return b.Bytes()
+}
+
+func post() []byte {
+	var b bytes.Buffer
+	write(&b, uint32(0x00030000), int32(0), int16(-100), int16(50),
+		uint32(0), uint32(0), uint32(0), uint32(0), uint32(0))
+	return b.Bytes()
+}
+
+// binarySearch the searchRange and entrySelector of n items of size bytes
+func binarySearch(n, size int) (uint16, uint16) {
+	power, log2 := 1, 0
+	for power*2 <= n {
+		power, log2 = power*2, log2+1
+	}
+	return uint16(power * size), uint16(log2)
+}
+
+func checksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+func main() {
+	glyf, loca := glyfLoca()
+	tables := map[string][]byte{
+		"OS/2": os2(), "cmap": cmap(), "glyf": glyf, "head": head(),
+		"hhea": hhea(), "hmtx": hmtx(), "kern": kern(), "loca": loca,
+		"maxp": maxp(), "name": name(), "post": post(),
+	}
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var b bytes.Buffer
+	n := len(tags)
+	searchRange, entrySelector := binarySearch(n, 16)
+	write(&b, uint32(0x00010000), uint16(n), searchRange, entrySelector,
+		uint16(n*16)-searchRange)
+	offset := 12 + 16*n
+	for _, tag := range tags {
+		data := tables[tag]
+		write(&b, []byte(tag), checksum(data), uint32(offset),
+			uint32(len(data)))
+		offset += (len(data) + 3) &^ 3
+	}
+	for _, tag := range tags {
+		data := tables[tag]
+		b.Write(data)
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+	if err := os.WriteFile("eyecandy-test.ttf", b.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
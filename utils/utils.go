@@ -10,13 +10,14 @@ import (
 	"time"
 
 	"github.com/Alquimista/eyecandy/interpolate"
-	"github.com/golang/freetype/truetype"
 
 	//"github.com/Alquimista/fonts"
 	// "github.com/stephenwithav/fontcache"
 	"github.com/Alquimista/eyecandy/fontcache"
 
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
 )
 
 const (
@@ -118,29 +119,47 @@ func AppendStrUnique(slice []string, s string) []string {
 // MeasureString returns the rendered width and height of the specified text
 // given the current font face.
 func MeasureString(ff font.Face, s string) (w float64, h float64) {
-	d := &font.Drawer{Face: ff}
-	ssampling := 1.0
-	w = float64(d.MeasureString(s)>>6) / ssampling
-	h = (float64(ff.Metrics().Height>>6) * 96 / 72) / ssampling
-	return
+	e := Measure(ff, s, [2]float64{100, 100}, 0, true)
+	return e.Width, e.Height
 }
 
-// LoadFont load and parse a truetype font.
+// LoadFont load and parse a font (regular weight).
 func LoadFont(fontName string, fontSize int) (face font.Face, err error) {
+	return LoadFontStyle(fontName, float64(fontSize),
+		fontcache.WeightRegular, false)
+}
 
-	fc := fontcache.New()
-	fc.Init(fontcache.FontPaths)
+// LoadFontStyle load and parse the font face closest to weight and italic.
+// Like the renderers the font size is the height of the font
+// (OS/2 usWinAscent + usWinDescent), see Face.
+func LoadFontStyle(fontName string, fontSize float64, weight int,
+	italic bool) (face font.Face, err error) {
 
-	// Retrieve font by name for use in a program.
-	f, ok := fc[strings.ToLower(fontName)]
-	if !ok {
-		return nil, nil
+	// Retrieve font by name for use in a program,
+	// a vertical font (@name) is the same font.
+	f, err := fontcache.Default.Find(strings.TrimPrefix(fontName, "@"),
+		weight, italic)
+	if err != nil {
+		return nil, err
 	}
-	face = truetype.NewFace(f, &truetype.Options{
-		Size: float64(fontSize) * 72.0 / 96.0,
+	size := fontSize
+	height := float64(f.Ascent + f.Descent)
+	ppem := size * float64(f.UnitsPerEm()) / height
+	ff, err := opentype.NewFace(f.Font, &opentype.FaceOptions{
+		Size: ppem,
 		DPI:  72,
 	})
-	return face, nil
+	if err != nil {
+		return nil, err
+	}
+	return &Face{
+		Face:    ff,
+		Font:    f.Font,
+		PPEM:    fixed.Int26_6(ppem*64 + 0.5),
+		Size:    size,
+		Ascent:  size * float64(f.Ascent) / height,
+		Descent: size * float64(f.Descent) / height,
+	}, nil
 }
 
 // LenString length of a string.
@@ -168,18 +187,30 @@ func ChangeSignF(n float64) float64 {
 }
 
 // RandomFloat random decimal number between min and max
+//
+// Deprecated: the global source is reseeded with the time in every call,
+// so the results can't be reproduced. Use the Rand of the Line
+// (Line.Rand or Emitter.Rand in ForEachLine), a random.Rand.
 func RandomFloat(min, max float64) float64 {
 	rand.Seed(time.Now().UnixNano())
 	return rand.Float64()*(max-min) + min
 }
 
 // RandomInt random number between min and max
+//
+// Deprecated: the global source is reseeded with the time in every call,
+// so the results can't be reproduced. Use the Rand of the Line
+// (Line.Rand or Emitter.Rand in ForEachLine), a random.Rand.
 func RandomInt(min, max int) int {
 	rand.Seed(time.Now().UnixNano())
 	return rand.Intn(max+1-min) + min
 }
 
 // RandomFloatRange random n numbers between min and max (float)
+//
+// Deprecated: the global source is reseeded with the time in every call,
+// so the results can't be reproduced. Use the Rand of the Line
+// (Line.Rand or Emitter.Rand in ForEachLine), a random.Rand.
 func RandomFloatRange(n int, min, max float64) (nums []float64) {
 	for i := 0; i < n; i++ {
 		nums = append(nums, RandomFloat(min, max))
@@ -188,6 +219,10 @@ func RandomFloatRange(n int, min, max float64) (nums []float64) {
 }
 
 // RandomIntRange random n numbers between min and max (integer)
+//
+// Deprecated: the global source is reseeded with the time in every call,
+// so the results can't be reproduced. Use the Rand of the Line
+// (Line.Rand or Emitter.Rand in ForEachLine), a random.Rand.
 func RandomIntRange(n, min, max int) (nums []int) {
 	for i := 0; i < n; i++ {
 		nums = append(nums, RandomInt(min, max))
@@ -198,18 +233,30 @@ func RandomIntRange(n, min, max int) (nums []int) {
 //TODO: Generic RandomChoice
 
 // RandomChoiceString select a random choice in a string slice
+//
+// Deprecated: the global source is reseeded with the time in every call,
+// so the results can't be reproduced. Use the Rand of the Line
+// (Line.Rand or Emitter.Rand in ForEachLine), a random.Rand.
 func RandomChoiceString(list []string) string {
 	rand.Seed(time.Now().UnixNano())
 	return list[rand.Intn(len(list))]
 }
 
 // RandomChoiceInt select a random choice in a int slice
+//
+// Deprecated: the global source is reseeded with the time in every call,
+// so the results can't be reproduced. Use the Rand of the Line
+// (Line.Rand or Emitter.Rand in ForEachLine), a random.Rand.
 func RandomChoiceInt(list []int) int {
 	rand.Seed(time.Now().UnixNano())
 	return list[rand.Intn(len(list))]
 }
 
 // RandomChoiceFloat select a random choice in a float64 slice
+//
+// Deprecated: the global source is reseeded with the time in every call,
+// so the results can't be reproduced. Use the Rand of the Line
+// (Line.Rand or Emitter.Rand in ForEachLine), a random.Rand.
 func RandomChoiceFloat(list []float64) float64 {
 	rand.Seed(time.Now().UnixNano())
 	return list[rand.Intn(len(list))]
@@ -0,0 +1,167 @@
+package eyecandy
+
+import (
+	"math"
+
+	"github.com/Alquimista/eyecandy/asstags"
+	"github.com/Alquimista/eyecandy/draw"
+	"github.com/Alquimista/eyecandy/reader"
+	"github.com/Alquimista/eyecandy/utils"
+)
+
+// verticalLowerBound the first char drawn upright by a vertical font
+// (@name) like libass, the chars before it (latin...) are rotated
+// with the Line
+const verticalLowerBound = 0x02f1
+
+// lineVertical get if a Line is vertical: the text is rotated 270
+// degrees, by the style angle or a \frz tag. Like the renderers a
+// vertical font (@name) alone only rotate its chars in place, see upright.
+func lineVertical(style *reader.Style, text string) bool {
+	angle := float64(style.Angle)
+	for _, node := range asstags.Parse(text) {
+		if block, ok := node.(*asstags.Block); ok {
+			for _, tag := range block.Tags {
+				if tag.Name != "frz" && tag.Name != "fr" {
+					continue
+				}
+				if v, err := tag.Float(); err == nil {
+					angle = v
+				}
+			}
+		}
+	}
+	return math.Mod(math.Mod(angle, 360)+360, 360) == 270
+}
+
+// upright get if a char is drawn upright, the CJK chars of a vertical font
+func (s *spanStyle) upright(c rune) bool {
+	return s.vertical && c >= verticalLowerBound
+}
+
+// runs call f with every upright char of a text
+// and every run of the other chars
+func (s *spanStyle) runs(text string, f func(run string, upright bool)) {
+	start := 0
+	for i, c := range text {
+		if !s.upright(c) {
+			continue
+		}
+		if i > start {
+			f(text[start:i], false)
+		}
+		f(string(c), true)
+		start = i + len(string(c))
+	}
+	if start < len(text) {
+		f(text[start:], false)
+	}
+}
+
+// width get the advance of a text in the span,
+// the upright chars advance the height of the font
+func (s *spanStyle) width(text string, kerning bool) (width float64) {
+	s.runs(text, func(run string, upright bool) {
+		if upright {
+			width += s.vertAdvance
+			return
+		}
+		width += utils.Measure(s.face, run, s.scale, s.spacing, kerning).Width
+	})
+	return width
+}
+
+// shape convert a text of the span into a vector drawing like draw.Text.
+// The upright chars are rotated 90 degrees and centered in the height of
+// the font, so the rotation of the vertical Line draw them upright.
+func (s *spanStyle) shape(text string, kerning bool) (*draw.Shape, error) {
+	faceMu.Lock()
+	defer faceMu.Unlock()
+	if !s.vertical {
+		return draw.Text(s.face, text, s.scale, s.spacing, kerning)
+	}
+	shape := draw.NewShape()
+	x := 0.0
+	var err error
+	s.runs(text, func(run string, upright bool) {
+		if err != nil {
+			return
+		}
+		var r *draw.Shape
+		r, err = draw.Text(s.face, run, s.scale, s.spacing, kerning)
+		if err != nil {
+			return
+		}
+		width := utils.Measure(s.face, run, s.scale, s.spacing, kerning).Width
+		if !upright {
+			shape = shape.Append(r.Translate(int(math.Round(x)), 0))
+			x += width
+			return
+		}
+		center := (s.ascent + s.descent + width) / 2.0
+		shape = shape.Append(r.Rotate(90).Translate(int(math.Round(x)),
+			int(math.Round(center))))
+		x += s.vertAdvance
+	})
+	return shape, err
+}
+
+// rotate convert a point of the layout to the screen. The rows of a
+// vertical Line are rotated 90 degrees clockwise around ox, oy like
+// \frz270, they run top to bottom and are stacked right to left.
+func (l *layout) rotate(x, y float64) (float64, float64) {
+	if !l.vertical {
+		return x, y
+	}
+	return l.ox - (y - l.oy), l.oy + (x - l.ox)
+}
+
+// rotateBox convert a box of the layout to the screen, see rotate
+func (l *layout) rotateBox(left, top, right,
+	bottom float64) (float64, float64, float64, float64) {
+	// the bottom left corner is the top left on the screen
+	sleft, stop := l.rotate(left, bottom)
+	sright, sbottom := l.rotate(right, top)
+	return sleft, stop, sright, sbottom
+}
+
+// rotateShape convert a vector drawing of a box of the layout of the
+// given height to the screen, the origin is the top left corner
+func (l *layout) rotateShape(shape *draw.Shape, height float64) *draw.Shape {
+	if !l.vertical {
+		return shape
+	}
+	return shape.Rotate(270).Translate(int(math.Round(height)), 0)
+}
+
+// orient convert the position and the box of a Dialog laid out
+// in the rows to the screen, see rotate
+func (l *layout) orient(d *Dialog) {
+	if !l.vertical {
+		return
+	}
+	d.X, d.Y = l.rotate(d.X, d.Y)
+	d.Left, d.Top, d.Right, d.Bottom = l.rotateBox(d.Left, d.Top,
+		d.Right, d.Bottom)
+	d.Width, d.Height = d.Right-d.Left, d.Bottom-d.Top
+	d.Size = [2]float64{d.Width, d.Height}
+	d.Center, d.Middle = d.Left+d.Width/2.0, d.Top+d.Height/2.0
+}
+
+// screenRows get the rows on the screen, see rotate
+func (l *layout) screenRows() []*Row {
+	if !l.vertical {
+		return l.rows
+	}
+	rows := make([]*Row, len(l.rows))
+	for i, row := range l.rows {
+		r := *row
+		r.X, r.Y = l.rotate(row.X, row.Y)
+		r.Left, r.Top, r.Right, r.Bottom = l.rotateBox(row.Left, row.Top,
+			row.Right, row.Bottom)
+		r.Width, r.Height = r.Right-r.Left, r.Bottom-r.Top
+		r.Center, r.Middle = r.Left+r.Width/2.0, r.Top+r.Height/2.0
+		rows[i] = &r
+	}
+	return rows
+}
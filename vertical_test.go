@@ -0,0 +1,72 @@
+package eyecandy
+
+import (
+	"fmt"
+	"testing"
+)
+
+// box the position of a Line, Syl or Char on the screen
+type box struct {
+	left, top, right, bottom, x, y float64
+}
+
+func dialogBox(d *Dialog) box {
+	return box{d.Left, d.Top, d.Right, d.Bottom, d.X, d.Y}
+}
+
+func TestVertical(t *testing.T) {
+	// A and V are 30px wide, あ (not in the test font) is upright in a
+	// vertical font and advance the height of the font, 60px. The rows of
+	// a vertical Line are rotated around its position (0, 0) by \an7.
+	tests := []struct {
+		name  string
+		font  string
+		angle int
+		text  string
+		line  box
+		units []box // the Syls, that are also the Chars
+	}{
+		{
+			"@font, angle 270", "@" + testFont, 270,
+			`{\k50}A{\k50}あ`,
+			box{-60, 0, 0, 90, 0, 0},
+			[]box{{-60, 0, 0, 30, 0, 0}, {-60, 30, 0, 90, 0, 30}},
+		},
+		{
+			"@font, angle 0", "@" + testFont, 0,
+			`{\k50}A{\k50}あ`,
+			box{0, 0, 90, 60, 0, 0},
+			[]box{{0, 0, 30, 60, 0, 0}, {30, 0, 90, 60, 30, 0}},
+		},
+		{
+			"\\frz270", testFont, 0,
+			`{\frz270\k50}A{\k50}V`,
+			box{-60, 0, 0, 60, 0, 0},
+			[]box{{-60, 0, 0, 30, 0, 0}, {-60, 30, 0, 60, 0, 30}},
+		},
+	}
+	for _, tt := range tests {
+		style := fmt.Sprintf("Style: Default,%s,60,&H00FFFFFF,&H000000FF,"+
+			"&H00000000,&H00000000,0,0,0,0,100,100,0,%d,1,0,0,7,0,0,0,1",
+			tt.font, tt.angle)
+		line := testScript(t, style, "Dialogue: 0,0:00:01.00,0:00:02.00,"+
+			"Default,,0,0,0,,"+tt.text+"\n").Lines()[0]
+		if got := dialogBox(&line.Dialog); got != tt.line {
+			t.Errorf("%s: Line = %v, want %v", tt.name, got, tt.line)
+		}
+		syls, chars := line.Syls(), line.Chars()
+		if len(syls) != len(tt.units) || len(chars) != len(tt.units) {
+			t.Errorf("%s: %d Syls and %d Chars, want %d", tt.name,
+				len(syls), len(chars), len(tt.units))
+			continue
+		}
+		for i, want := range tt.units {
+			if got := dialogBox(&syls[i].Dialog); got != want {
+				t.Errorf("%s: Syl %d = %v, want %v", tt.name, i, got, want)
+			}
+			if got := dialogBox(&chars[i].Dialog); got != want {
+				t.Errorf("%s: Char %d = %v, want %v", tt.name, i, got, want)
+			}
+		}
+	}
+}
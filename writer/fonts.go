@@ -0,0 +1,78 @@
+package writer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// uuLineLength characters by line of the encoded attachments
+const uuLineLength = 80
+
+// uuencode encode data in the SSA variant of UUencode: every character
+// keep 6 bits (value + 33). A last group of 1 or 2 bytes is encoded
+// in 2 or 3 characters.
+func uuencode(data []byte) string {
+	var sb strings.Builder
+	sb.Grow((len(data)*4 + 2) / 3)
+	for i := 0; i < len(data); i += 3 {
+		var group [3]byte
+		n := copy(group[:], data[i:])
+		chars := [4]byte{
+			group[0] >> 2,
+			(group[0]&0x3)<<4 | group[1]>>4,
+			(group[1]&0xf)<<2 | group[2]>>6,
+			group[2] & 0x3f,
+		}
+		for _, c := range chars[:n+1] {
+			sb.WriteByte(c + 33)
+		}
+	}
+	return sb.String()
+}
+
+// fontFileName the name of an embedded font,
+// SSA add the font encoding to the file name (arial.ttf -> arial_0.ttf)
+func fontFileName(name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(filepath.Base(name), ext)
+	if !strings.HasSuffix(base, "_0") {
+		base += "_0"
+	}
+	return base + ext
+}
+
+// AddFont embed a font in the [Fonts] section of the SSA/ASS Script.
+func (s *Script) AddFont(name string, data []byte) {
+	var sec *Section
+	for _, ss := range s.Sections {
+		if strings.EqualFold(ss.Name, "Fonts") {
+			sec = ss
+			break
+		}
+	}
+	if sec == nil {
+		sec = &Section{Name: "Fonts"}
+		s.Sections = append(s.Sections, sec)
+	}
+	sec.Lines = append(sec.Lines, "fontname: "+fontFileName(name))
+	encoded := uuencode(data)
+	for len(encoded) > uuLineLength {
+		sec.Lines = append(sec.Lines, encoded[:uuLineLength])
+		encoded = encoded[uuLineLength:]
+	}
+	if encoded != "" {
+		sec.Lines = append(sec.Lines, encoded)
+	}
+}
+
+// AttachFont embed a font file in the [Fonts] section of the SSA/ASS Script.
+func (s *Script) AttachFont(fn string) error {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("writer: failed attaching font: %s", err)
+	}
+	s.AddFont(fn, data)
+	return nil
+}
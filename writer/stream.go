@@ -0,0 +1,96 @@
+package writer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Stream write a Script while its dialogs are added, without keeping
+// them: the headers and the styles first, then every Dialog added and
+// the Sections when it's closed. The errors are kept until Close.
+type Stream struct {
+	s       *Script
+	w       *bufio.Writer
+	closers []io.Closer // gzip and file, closed in order
+	err     error
+}
+
+// NewStream start writing the Script s to w (without BOM): its headers,
+// its styles like WriteTo and its dialogs. The Script must not change but
+// its Sections, written by Close; a missing style used only by the
+// dialogs added after isn't written.
+func NewStream(w io.Writer, s *Script) (*Stream, error) {
+	st := &Stream{s: s, w: bufio.NewWriter(w)}
+	if err := tmpl.ExecuteTemplate(st.w, "header",
+		s.withDefaults()); err != nil {
+		return nil, fmt.Errorf("writer: failed writing subtitle: %s", err)
+	}
+	for _, d := range s.Dialog {
+		st.AddDialog(d)
+	}
+	return st, st.err
+}
+
+// CreateStream create an SSA/ASS Subtitle Script and start writing it
+// like NewStream, a file name ending in ".gz" is compressed with gzip
+func CreateStream(fn string, s *Script) (*Stream, error) {
+	f, err := os.Create(fn)
+	if err != nil {
+		return nil, fmt.Errorf("writer: failed saving subtitle file: %s", err)
+	}
+	s.MetaFilename = fn
+
+	var w io.Writer = f
+	closers := []io.Closer{f}
+	if strings.HasSuffix(strings.ToLower(fn), ".gz") {
+		gz := gzip.NewWriter(f)
+		w, closers = gz, []io.Closer{gz, f}
+	}
+	if _, err := io.WriteString(w, BOM); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("writer: failed saving subtitle file: %s", err)
+	}
+	st, err := NewStream(w, s)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	st.closers = closers
+	return st, nil
+}
+
+// AddDialog write a Dialog, the empty ones are skipped like in
+// Script.AddDialog
+func (st *Stream) AddDialog(d *Dialog) error {
+	if st.err != nil || d.Text == "" {
+		return st.err
+	}
+	if _, err := st.w.WriteString("\n" + d.String()); err != nil {
+		st.err = fmt.Errorf("writer: failed writing subtitle: %s", err)
+	}
+	return st.err
+}
+
+// Close write the Sections of the Script and flush the Stream,
+// the file of CreateStream is closed
+func (st *Stream) Close() error {
+	if st.err == nil {
+		if err := tmpl.ExecuteTemplate(st.w, "footer", st.s); err != nil {
+			st.err = fmt.Errorf("writer: failed writing subtitle: %s", err)
+		}
+	}
+	if err := st.w.Flush(); err != nil && st.err == nil {
+		st.err = fmt.Errorf("writer: failed writing subtitle: %s", err)
+	}
+	for _, c := range st.closers {
+		if err := c.Close(); err != nil && st.err == nil {
+			st.err = fmt.Errorf("writer: failed saving subtitle file: %s", err)
+		}
+	}
+	st.closers = nil
+	return st.err
+}
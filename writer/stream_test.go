@@ -0,0 +1,92 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readStream read a file written by CreateStream, gunzipped if it's .gz
+func readStream(t *testing.T, fn string) []byte {
+	t.Helper()
+	f, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if filepath.Ext(fn) == ".gz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCreateStream(t *testing.T) {
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append([]byte(BOM), want...)
+	for _, name := range []string{"script.ass", "script.ass.gz"} {
+		fn := filepath.Join(t.TempDir(), name)
+		st, err := CreateStream(fn, testScript())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := st.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readStream(t, fn); !bytes.Equal(got, want) {
+			t.Errorf("%s:\n%s\nwant like Save:\n%s", name, got, want)
+		}
+	}
+}
+
+func TestStreamAddDialog(t *testing.T) {
+	var want bytes.Buffer
+	if _, err := testScript().WriteTo(&want); err != nil {
+		t.Fatal(err)
+	}
+	// the style missing for a dialog added after the headers isn't written
+	missing := NewStyle("Missing").String() + "\n"
+	if !bytes.Contains(want.Bytes(), []byte(missing)) {
+		t.Fatalf("no %q in:\n%s", missing, want.Bytes())
+	}
+	wantStream := bytes.Replace(want.Bytes(), []byte(missing), nil, 1)
+
+	s := testScript()
+	dialogs := s.Dialog
+	s.Dialog = nil
+	var b bytes.Buffer
+	st, err := NewStream(&b, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range dialogs {
+		if err := st.AddDialog(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.AddDialog(NewDialog("")); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), wantStream) {
+		t.Errorf("stream:\n%s\nwant:\n%s", b.Bytes(), wantStream)
+	}
+}
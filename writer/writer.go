@@ -3,9 +3,13 @@ package writer
 
 import (
 	"bytes"
+	_ "embed" // script template
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"strings"
+	"text/template"
 
 	"github.com/Alquimista/eyecandy/asstime"
 	"github.com/Alquimista/eyecandy/color"
@@ -16,44 +20,17 @@ import (
 const dummyVideoTemplate string = "?dummy:%.6f:%d:%d:%d:%d:%d:%d%s:"
 const dummyAudioTemplate string = "dummy-audio:silence?sr=44100&bd=16&" +
 	"ch=1&ln=396900000:" // silence?, noise? TODO: dummy audio function
-const styleFormat string = "Format: Name, Fontname, Fontsize, " +
-	"PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, " +
-	"Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, " +
-	"BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, " +
-	"Encoding"
 const styleTemplate string = "Style: %s,%s,%d,%s,%s,%s,%s,%s,%s,%s,%s,%.4f," +
-	"%.4f,%.1f,%d,%d,%.4f,%.4f,%d,%04d,%04d,%04d,1"
-const dialogFormat string = "Format: Layer, Start, End, Style, Name, " +
-	"MarginL, MarginR, MarginV, Effect, Text"
-const dialogTemplate string = "%s: %d,%s,%s,%s,%s,0000,0000,0000,%s,%s"
-const scriptTemplate string = `[Script Info]
-; %s
-Title: %s
-Original Script: %s
-Translation: %s
-Timing: %s
-ScriptType: v4.00+
-PlayResX: %d
-PlayResY: %d
-WrapStyle: 2
-ScaledBorderAndShadow: yes
-YCbCr Matrix: TV.601
-
-[Aegisub Project Garbage]
-Video File: %s
-Video AR Mode: 4
-Video AR Value: %.6f
-Video Zoom Percent: %.6f
-Video Position: %d
-Audio File: %s
-Active Line: 1
-
-[V4+ Styles]
-%s
-%s
-[Events]
-%s
-%s`
+	"%.4f,%.1f,%d,%d,%.4f,%.4f,%d,%04d,%04d,%04d,%d"
+const dialogTemplate string = "%s: %d,%s,%s,%s,%s,%04d,%04d,%04d,%s,%s"
+
+// BOM Byte Order Mark written at the start of the saved scripts
+const BOM string = "\uFEFF"
+
+//go:embed template.ass.gotmpl
+var scriptTemplate string
+
+var tmpl = template.Must(template.New("script").Parse(scriptTemplate))
 
 const (
 	// AlignBottomLeft Bottom Left SSA numbered Alignment
@@ -131,6 +108,7 @@ func (sty *Style) String() string {
 		sty.Bord, sty.Shadow,
 		sty.Alignment,
 		sty.Margin[0], sty.Margin[1], sty.Margin[2],
+		sty.Encoding,
 	)
 }
 
@@ -156,10 +134,11 @@ func NewStyle(name string) *Style {
 // Dialog Represent the subtitle"s lines.
 type Dialog struct {
 	Layer     int
-	Start     string
-	End       string
+	Start     asstime.Time
+	End       asstime.Time
 	StyleName string
 	Actor     string
+	Margin    [3]int // L, R, V (0 use the Style margin)
 	Effect    string
 	Text      string
 	Tags      string
@@ -181,6 +160,7 @@ func (d *Dialog) String() string {
 		d.Layer,
 		d.Start, d.End,
 		d.StyleName, d.Actor,
+		d.Margin[0], d.Margin[1], d.Margin[2],
 		d.Effect,
 		text)
 }
@@ -189,15 +169,75 @@ func (d *Dialog) String() string {
 func NewDialog(text string) *Dialog {
 	return &Dialog{
 		StyleName: "Default",
-		Start:     "0:00:00.00", End: "0:00:05.00",
+		Start:     0, End: 5 * asstime.Second,
 		Text: text}
 }
 
+// Field a "Key: Value" line of the [Script Info]
+// or [Aegisub Project Garbage] sections.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// String get the Field as a String
+func (f Field) String() string {
+	return f.Key + ": " + f.Value
+}
+
+// Section a section written verbatim after [Events]
+// ([Fonts], [Graphics], [Aegisub Extradata]...).
+type Section struct {
+	Name  string // without brackets
+	Lines []string
+}
+
+// String get the Section as a String
+func (sec *Section) String() string {
+	return "[" + sec.Name + "]\n" + strings.Join(sec.Lines, "\n")
+}
+
+// defaultInfo [Script Info] keys written if they aren't in Script.Info
+var defaultInfo = []Field{
+	{"WrapStyle", "2"},
+	{"ScaledBorderAndShadow", "yes"},
+	{"YCbCr Matrix", "TV.601"},
+}
+
+// defaultGarbage [Aegisub Project Garbage] keys written
+// if they aren't in Script.Garbage
+var defaultGarbage = []Field{
+	{"Video AR Mode", "4"},
+	{"Active Line", "1"},
+}
+
+// mergeFields append extra to defaults,
+// the values of extra replace the defaults with the same key.
+func mergeFields(defaults, extra []Field) (fields []Field) {
+	for _, d := range defaults {
+		found := false
+		for _, f := range extra {
+			if strings.EqualFold(d.Key, f.Key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fields = append(fields, d)
+		}
+	}
+	return append(fields, extra...)
+}
+
 // Script SSA/ASS Subtitle Script.
 type Script struct {
 	Dialog             []*Dialog
 	Style              map[string]*Style
 	Comment            string
+	Comments           []string // extra [Script Info] comments
+	Info               []Field  // extra [Script Info] keys
+	Garbage            []Field  // extra [Aegisub Project Garbage] keys
+	Sections           []*Section
 	Resolution         [2]int // WIDTH, HEIGHT map[string]string
 	VideoPath          string
 	VideoZoom          float64
@@ -212,12 +252,17 @@ type Script struct {
 }
 
 // GetStyle get the Style matching the argument name if exist
-// else return the Default Style
+// else return a copy of the Default Style with that name
 func (s *Script) GetStyle(name string) *Style {
 	style, ok := s.Style[name]
 	if !ok {
-		style = s.Style["Default"]
-		style.Name = name
+		sty, ok := s.Style["Default"]
+		if !ok {
+			return NewStyle(name)
+		}
+		copySty := *sty
+		copySty.Name = name
+		style = &copySty
 	}
 	return style
 }
@@ -242,105 +287,130 @@ func (s *Script) AddDialog(d *Dialog) {
 	}
 }
 
-// String get the generated SSA/ASS Script as a String
-func (s *Script) String() string {
+// Styles list the styles written: all the styles of the Script, by
+// name, then the missing ones used in the not commented dialogs, in order
+// of appearance, created from the Default style.
+func (s *Script) Styles() (styles []*Style) {
+	for _, sty := range s.Style {
+		styles = append(styles, sty)
+	}
+	sort.Slice(styles, func(i, j int) bool {
+		return styles[i].Name < styles[j].Name
+	})
+	var names []string
+	for _, d := range s.Dialog {
+		if !d.Comment && !s.StyleExists(d.StyleName) {
+			names = utils.AppendStrUnique(names, d.StyleName)
+		}
+	}
+	for _, name := range names {
+		styles = append(styles, s.GetStyle(name))
+	}
+	return styles
+}
+
+// InfoFields list the [Script Info] keys not written from other fields
+func (s *Script) InfoFields() []Field {
+	return mergeFields(defaultInfo, s.Info)
+}
+
+// GarbageFields list the [Aegisub Project Garbage] keys
+// not written from other fields
+func (s *Script) GarbageFields() []Field {
+	return mergeFields(defaultGarbage, s.Garbage)
+}
 
-	// Add default dialog and style
-	s.AddStyle(NewStyle("Default"))
-	if len(s.Dialog) == 0 {
-		s.AddDialog(NewDialog("EyecandyFX"))
+// withDefaults get a copy of the Script with the empty fields filled.
+func (s *Script) withDefaults() *Script {
+	c := *s
+
+	if c.Style == nil {
+		c.Style = map[string]*Style{}
+	}
+	if len(c.Dialog) == 0 {
+		c.Dialog = []*Dialog{NewDialog("EyecandyFX")}
 	}
 
-	if s.Resolution[0] == 0 || s.Resolution[1] == 0 {
-		s.Resolution = [2]int{1280, 720}
+	if c.Resolution[0] == 0 || c.Resolution[1] == 0 {
+		c.Resolution = [2]int{1280, 720}
 	}
 
-	if s.MetaOriginalScript == "" {
-		s.MetaOriginalScript = s.MetaFilename
+	if c.MetaOriginalScript == "" {
+		c.MetaOriginalScript = c.MetaFilename
 	}
 
-	if s.VideoAR == 0 {
-		s.VideoAR = float64(s.Resolution[0]) / float64(s.Resolution[1])
+	if c.VideoAR == 0 {
+		c.VideoAR = float64(c.Resolution[0]) / float64(c.Resolution[1])
 	}
-	if s.VideoPath == "" {
-		s.VideoPath = DummyVideo(
+	if c.VideoPath == "" {
+		c.VideoPath = DummyVideo(
 			asstime.FpsNtscFilm,
-			s.Resolution[0], s.Resolution[1],
+			c.Resolution[0], c.Resolution[1],
 			"#000",
 			false,
 			600)
 	}
-	if s.VideoPath != "" {
-		if strings.HasPrefix(s.VideoPath, "?dummy") {
-			s.Audio = dummyAudioTemplate
-		} else {
-			s.Audio = s.VideoPath
-		}
+	if strings.HasPrefix(c.VideoPath, "?dummy") {
+		c.Audio = dummyAudioTemplate
+	} else {
+		c.Audio = c.VideoPath
 	}
+	return &c
+}
 
-	var dialogStyleNames []string
-	var styles bytes.Buffer
-	var dialogs bytes.Buffer
+// countWriter count the bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
 
-	for _, d := range s.Dialog {
-		if !d.Comment {
-			dialogStyleNames = utils.AppendStrUnique(
-				dialogStyleNames, d.StyleName)
-		}
-		dialogs.WriteString(d.String() + "\n")
-	}
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
 
-	// Write only used styles in dialogs
-	// If doesn't exist create it
-	for _, sname := range dialogStyleNames {
-		_, ok := s.Style[sname]
-		i := 0
-		for _, sty := range s.Style {
-			if !ok {
-				sty = s.Style["Default"]
-				sty.Name = sname
-				i++
-			} else {
-				i = 1
-			}
-			if sty.Name == sname && i == 1 {
-				styles.WriteString(sty.String() + "\n")
-			}
-		}
+// WriteTo write the SSA/ASS Script to w (without BOM).
+func (s *Script) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	if err := tmpl.Execute(cw, s.withDefaults()); err != nil {
+		return cw.n, fmt.Errorf("writer: failed writing subtitle: %s", err)
 	}
+	return cw.n, nil
+}
 
-	return fmt.Sprintf(scriptTemplate,
-		s.Comment,
-		s.MetaTitle, s.MetaOriginalScript,
-		s.MetaTranslation, s.MetaTiming,
-		s.Resolution[0], s.Resolution[1],
-		s.VideoPath, s.VideoAR, s.VideoZoom, s.VideoPosition,
-		s.Audio,
-		styleFormat, styles.String(),
-		dialogFormat, dialogs.String())
-
+// String get the generated SSA/ASS Script as a String
+func (s *Script) String() string {
+	var buff bytes.Buffer
+	if _, err := s.WriteTo(&buff); err != nil {
+		return ""
+	}
+	return buff.String()
 }
 
 // Save write an SSA/ASS Subtitle Script.
-func (s *Script) Save(fn string) {
+func (s *Script) Save(fn string) error {
 
-	BOM := "\uFEFF"
 	f, err := os.Create(fn)
 	if err != nil {
-		panic(fmt.Errorf("writer: failed saving subtitle file: %s", err))
+		return fmt.Errorf("writer: failed saving subtitle file: %s", err)
 	}
 	defer f.Close()
 
 	s.MetaFilename = fn
 
-	n, err := f.WriteString(BOM + s.String())
-	if err != nil {
-		fmt.Println(n, err)
+	if _, err := io.WriteString(f, BOM); err != nil {
+		return fmt.Errorf("writer: failed saving subtitle file: %s", err)
+	}
+	if _, err := s.WriteTo(f); err != nil {
+		return err
 	}
 
 	// save changes
-	// err =
-	f.Sync()
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("writer: failed saving subtitle file: %s", err)
+	}
+	return f.Close()
 }
 
 // NewScript create a new Script Struct with defaults
@@ -0,0 +1,152 @@
+package writer
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Alquimista/eyecandy/asstime"
+	"github.com/Alquimista/eyecandy/color"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const golden = "testdata/script.ass"
+
+// testScript a Script with styles, dialogs, [Fonts] and [Graphics]
+func testScript() *Script {
+	s := NewScript()
+	s.Resolution = [2]int{1280, 720}
+	s.VideoPath = "video.mkv"
+	s.VideoPosition = 120
+	s.MetaOriginalScript = "Someone"
+	s.MetaTiming = "Someone else"
+	s.Comments = []string{"an extra comment"}
+	s.Info = []Field{{"WrapStyle", "0"}, {"Kerning", "yes"}}
+	s.Garbage = []Field{{"Active Line", "3"}, {"Scroll Position", "2"}}
+
+	s.AddStyle(NewStyle("Default"))
+	kara := NewStyle("Kara")
+	kara.FontName = "Eyecandy Test"
+	kara.FontSize = 60
+	kara.Color[0] = color.NewFromHTML("#93BEC2")
+	kara.Bold = true
+	kara.Scale = [2]float64{120, 90}
+	kara.Spacing = 1.5
+	kara.Angle = 270
+	kara.OpaqueBox = true
+	kara.Bord, kara.Shadow = 1.2, 3
+	kara.Alignment = AlignTopLeft
+	kara.Margin = [3]int{5, 6, 7}
+	kara.Encoding = 128
+	s.AddStyle(kara)
+	s.AddStyle(NewStyle("Unused"))
+
+	comment := NewDialog("### Original Karaoke ###")
+	comment.Comment = true
+	comment.StyleName = "Unused"
+	s.AddDialog(comment)
+	d := NewDialog("{\\k20}Ka{\\k30}ra")
+	d.Layer = 2
+	d.Start, d.End = asstime.NewTime(0, 1, 2, 30), asstime.NewTime(1, 2, 3, 40)
+	d.StyleName = "Kara"
+	d.Actor = "Me"
+	d.Margin = [3]int{10, 0, 25}
+	d.Effect = "karaoke"
+	d.Tags = `\pos(10,20)`
+	s.AddDialog(d)
+	s.AddDialog(NewDialog("")) // skipped
+	missing := NewDialog("a style copied from Default")
+	missing.StyleName = "Missing"
+	s.AddDialog(missing)
+
+	s.AddFont("fonts/eyecandy.ttf", []byte("not really a font, but data"))
+	s.Sections = append(s.Sections, &Section{Name: "Graphics",
+		Lines: []string{"filename: logo.png", uuencode([]byte{0, 1, 2, 3})}})
+	return s
+}
+
+func TestWriteTo(t *testing.T) {
+	var b bytes.Buffer
+	n, err := testScript().WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("WriteTo = %d, wrote %d bytes", n, b.Len())
+	}
+	if *update {
+		if err := ioutil.WriteFile(golden, b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("WriteTo:\n%s\nwant:\n%s", b.Bytes(), want)
+	}
+
+	fn := filepath.Join(t.TempDir(), "script.ass")
+	if err := testScript().Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(saved, append([]byte(BOM), want...)) {
+		t.Errorf("Save:\n%s\nwant BOM and:\n%s", saved, want)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	sty := NewStyle("Default")
+	if sty.Alignment != AlignBottomCenter || sty.Encoding != 0 {
+		t.Errorf("NewStyle: Alignment %d, Encoding %d, want %d, 0",
+			sty.Alignment, sty.Encoding, AlignBottomCenter)
+	}
+
+	want := "[Script Info]\n" +
+		"; Script generated by Eyecandy\n" +
+		"Title: Default Eyecandy file\n" +
+		"Original Script: \n" +
+		"Translation: \n" +
+		"Timing: \n" +
+		"ScriptType: v4.00+\n" +
+		"PlayResX: 1280\n" +
+		"PlayResY: 720\n" +
+		"WrapStyle: 2\n" +
+		"ScaledBorderAndShadow: yes\n" +
+		"YCbCr Matrix: TV.601\n" +
+		"\n" +
+		"[Aegisub Project Garbage]\n" +
+		"Video File: ?dummy:23.976000:14386:1280:720:0:0:0:\n" +
+		"Video AR Value: 1.777778\n" +
+		"Video Zoom Percent: 0.750000\n" +
+		"Video Position: 0\n" +
+		"Audio File: " + dummyAudioTemplate + "\n" +
+		"Video AR Mode: 4\n" +
+		"Active Line: 1\n" +
+		"\n" +
+		"[V4+ Styles]\n" +
+		"Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, " +
+		"OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, " +
+		"ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, " +
+		"Alignment, MarginL, MarginR, MarginV, Encoding\n" +
+		"Style: Default,Arial,35,&H00FFFFFF,&H00FF0000,&H00000000," +
+		"&H00000000,0,0,0,0,100.0000,100.0000,0.0,0,0,2.0000,0.0000,2," +
+		"0010,0020,0010,0\n" +
+		"\n" +
+		"[Events]\n" +
+		"Format: Layer, Start, End, Style, Name, MarginL, MarginR, " +
+		"MarginV, Effect, Text\n" +
+		"Dialogue: 0,0:00:00.00,0:00:05.00,Default,,0000,0000,0000,," +
+		"EyecandyFX\n"
+	if got := NewScript().String(); got != want {
+		t.Errorf("empty Script:\n%s\nwant:\n%s", got, want)
+	}
+}